@@ -0,0 +1,230 @@
+package gutenberg
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	blackfriday "github.com/russross/blackfriday"
+	"regexp"
+	"strings"
+)
+
+// Admonitions are blocks set apart from the text such as notes and warnings.
+// They are written either with an indented body
+//
+//	!!! note "Optional title"
+//	    The body is markdown indented by four spaces.
+//
+// or between colon fences
+//
+//	:::warning Optional title
+//	The body is markdown up to the closing fence.
+//	:::
+//
+// Blackfriday has no way to add block syntax so the admonitions are turned
+// into fenced code blocks with the admonition language before the markdown is
+// parsed, the renderers then render the body of those blocks in their own form.
+const admonitionLang = "admonition"
+
+// Matches the first line of an indented admonition, the groups are the type
+// and the optional quoted title
+var admonitionIndented = regexp.MustCompile(`^!!!\s*([a-zA-Z][\w-]*)(?:\s+"(.*)")?\s*$`)
+
+// Matches the opening colon fence, the groups are the type and the title
+var admonitionFence = regexp.MustCompile(`^:::\s*([a-zA-Z][\w-]*)(?:\s+(.*?))?\s*$`)
+
+// Matches the closing colon fence
+var admonitionFenceEnd = regexp.MustCompile(`^:::\s*$`)
+
+// Matches the runs of backticks in the body of an admonition
+var backtickRun = regexp.MustCompile("`+")
+
+type admonitionParameters struct {
+	Type  string `json:"type"`
+	Title string `json:"title"`
+}
+
+// Replace the admonitions in the markdown with fenced code blocks for the
+// renderers, fenced code blocks are left alone
+func ExpandAdmonitions(markdown []byte) []byte {
+	if !bytes.Contains(markdown, []byte("!!!")) && !bytes.Contains(markdown, []byte(":::")) {
+		return markdown
+	}
+
+	lines := strings.Split(string(markdown), "\n")
+	out := make([]string, 0, len(lines))
+	fence := ""
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+
+		// Nothing inside fenced code is an admonition
+		fence = trackFence(fence, line)
+		if fence != "" {
+			out = append(out, line)
+			continue
+		}
+
+		var kind, title string
+		var body []string
+		if match := admonitionIndented.FindStringSubmatch(line); match != nil {
+			kind, title = match[1], match[2]
+			body, i = indentedBody(lines, i+1)
+		} else if match := admonitionFence.FindStringSubmatch(line); match != nil {
+			kind, title = match[1], match[2]
+			body, i = fencedBody(lines, i+1)
+		} else {
+			out = append(out, line)
+			continue
+		}
+
+		out = append(out, "", admonitionBlock(kind, title, strings.Join(body, "\n")), "")
+	}
+
+	return []byte(strings.Join(out, "\n"))
+}
+
+// Returns the lines indented by four spaces or a tab after the start line with
+// the indentation removed and the index of the last line of the body
+func indentedBody(lines []string, start int) ([]string, int) {
+	body := make([]string, 0)
+	last := start - 1
+
+	for i := start; i < len(lines); i++ {
+		line := lines[i]
+		if strings.TrimSpace(line) == "" {
+			body = append(body, "")
+			continue
+		}
+
+		if strings.HasPrefix(line, "    ") {
+			line = line[4:]
+		} else if strings.HasPrefix(line, "\t") {
+			line = line[1:]
+		} else {
+			break
+		}
+
+		body = append(body, line)
+		last = i
+	}
+
+	// Blank lines after the body belong to the text that follows
+	return body[:last-start+1], last
+}
+
+// Returns the lines up to the closing colon fence and the index of the fence,
+// closing fences in fenced code blocks are skipped
+func fencedBody(lines []string, start int) ([]string, int) {
+	fence := ""
+
+	for i := start; i < len(lines); i++ {
+		line := lines[i]
+		fence = trackFence(fence, line)
+		if fence == "" && admonitionFenceEnd.MatchString(line) {
+			return lines[start:i], i
+		}
+	}
+
+	// An admonition that is never closed runs to the end of the page
+	return lines[start:], len(lines) - 1
+}
+
+// Write the admonition as a fenced code block, the fence is longer than any
+// run of backticks in the body so code blocks in the body stay inside
+func admonitionBlock(kind string, title string, body string) string {
+	if title == "" {
+		title = strings.ToUpper(kind[:1]) + kind[1:]
+	}
+
+	parameters, _ := json.Marshal(&admonitionParameters{Type: strings.ToLower(kind), Title: title})
+	// The info string of a fenced code block ends at the first space
+	info := strings.Replace(string(parameters), " ", `\u0020`, -1)
+
+	fence := "```"
+	for _, run := range backtickRun.FindAllString(body, -1) {
+		if len(run) >= len(fence) {
+			fence = strings.Repeat("`", len(run)+1)
+		}
+	}
+
+	return fmt.Sprintf("%s%s%s\n%s\n%s", fence, admonitionLang, info, body, fence)
+}
+
+// Returns the parameters of the admonition if the language of a code block is
+// the admonition language
+func admonition(lang string) (*admonitionParameters, bool) {
+	if !strings.HasPrefix(lang, admonitionLang+"{") {
+		return nil, false
+	}
+
+	params := &admonitionParameters{}
+	if err := json.Unmarshal([]byte(lang[len(admonitionLang):]), params); err != nil {
+		return nil, false
+	}
+
+	return params, true
+}
+
+// Render the body of an admonition with the renderer of the page so headings,
+// links and included code work like in the rest of the page
+func renderAdmonitionBody(renderer blackfriday.Renderer, body []byte) []byte {
+	return blackfriday.Markdown(prepareMarkdown(body), renderer, markdownExtensions())
+}
+
+// Matches the notes pages wrote in raw html before there were admonitions,
+// the groups are the title and the body
+var rawNote = regexp.MustCompile(`(?ms)^<div class="note">\s*<div class="note_title">(.*?)</div>\s*<div class="note_body">(.*?)</div>\s*</div>[ \t]*$`)
+
+// The html the notes used and the markdown it is replaced with, paragraph
+// tags on lines of their own become blank lines
+var noteHtml = []struct {
+	tag         *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`(?m)^[ \t]*</?p\s*/?>[ \t]*$`), ""},
+	{regexp.MustCompile(`(?s)<strong>(.*?)</strong>`), "**$1**"},
+	{regexp.MustCompile(`(?s)<b>(.*?)</b>`), "**$1**"},
+	{regexp.MustCompile(`(?s)<em>(.*?)</em>`), "*$1*"},
+	{regexp.MustCompile(`(?s)<i>(.*?)</i>`), "*$1*"},
+	{regexp.MustCompile(`<code>([^<` + "`" + `]*)</code>`), "`$1`"},
+}
+
+// Rewrite the raw html notes in a page as admonitions, returns the page and
+// the number of notes that were rewritten
+func MigrateNotes(markdown []byte) ([]byte, int) {
+	count := 0
+	result := rawNote.ReplaceAllFunc(markdown, func(note []byte) []byte {
+		match := rawNote.FindSubmatch(note)
+		count++
+
+		title := strings.TrimSpace(string(match[1]))
+		header := "!!! note"
+		if title != "" && !strings.EqualFold(title, "note") {
+			header = fmt.Sprintf("!!! note \"%s\"", title)
+		}
+
+		body := string(match[2])
+		for _, html := range noteHtml {
+			body = html.tag.ReplaceAllString(body, html.replacement)
+		}
+
+		// Leave out the blank lines around the body and indent it
+		bodyLines := strings.Split(body, "\n")
+		for len(bodyLines) > 0 && strings.TrimSpace(bodyLines[0]) == "" {
+			bodyLines = bodyLines[1:]
+		}
+		for len(bodyLines) > 0 && strings.TrimSpace(bodyLines[len(bodyLines)-1]) == "" {
+			bodyLines = bodyLines[:len(bodyLines)-1]
+		}
+
+		lines := []string{header}
+		for _, line := range reindent(bodyLines, 4) {
+			lines = append(lines, strings.TrimRight(line, " \t"))
+		}
+
+		return []byte(strings.Join(lines, "\n"))
+	})
+
+	return result, count
+}
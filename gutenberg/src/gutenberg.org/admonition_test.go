@@ -0,0 +1,90 @@
+package gutenberg
+
+import (
+	"gutenberg.org/config"
+	"testing"
+)
+
+/**
+ * Tests
+ **/
+func TestIndentedAdmonition(t *testing.T) {
+	markdown := "Text\n\n" +
+		"!!! note\n" +
+		"    Uses **$nin**.\n\n" +
+		"    Second paragraph.\n\n" +
+		"After\n"
+
+	html := string(NewCustomHtml(&config.Config{}, nil).Transform([]byte(markdown)))
+	expected := "<p>Text</p>\n\n" +
+		"<div class=\"admonition note\">\n" +
+		"<div class=\"admonition_title\">Note</div>\n" +
+		"<div class=\"admonition_body\">\n" +
+		"<p>Uses <strong>$nin</strong>.</p>\n\n" +
+		"<p>Second paragraph.</p>\n" +
+		"</div>\n" +
+		"</div>\n\n" +
+		"<p>After</p>\n"
+
+	if html != expected {
+		t.Errorf("expected %q got %q", expected, html)
+	}
+}
+
+func TestFencedAdmonition(t *testing.T) {
+	markdown := ":::warning Take care\n" +
+		"```text\n" +
+		":::\n" +
+		"```\n" +
+		":::\n"
+
+	html := string(NewCustomHtml(&config.Config{}, nil).Transform([]byte(markdown)))
+	expected := "<div class=\"admonition warning\">\n" +
+		"<div class=\"admonition_title\">Take care</div>\n" +
+		"<div class=\"admonition_body\">\n" +
+		"<pre class=\"highlight\"><code class=\"text\">:::\n" +
+		"</code></pre>\n" +
+		"</div>\n" +
+		"</div>\n"
+
+	if html != expected {
+		t.Errorf("expected %q got %q", expected, html)
+	}
+}
+
+func TestAdmonitionInCode(t *testing.T) {
+	markdown := "```\n!!! note\n    not a note\n```\n"
+
+	if expanded := string(ExpandAdmonitions([]byte(markdown))); expanded != markdown {
+		t.Errorf("expected %q got %q", markdown, expanded)
+	}
+}
+
+func TestMigrateNotes(t *testing.T) {
+	markdown := "Before\n\n" +
+		"<div class=\"note\">\n" +
+		"    <div class=\"note_title\">Note</div>\n" +
+		"    <div class=\"note_body\">\n" +
+		"      The <strong>$mod</strong> operator cannot use an index.\n" +
+		"      <p/>\n" +
+		"      Avoid it.\n" +
+		"    </div>\n" +
+		"</div>\n\n" +
+		"<div class=\"note\"><div class=\"note_title\">Indexes</div><div class=\"note_body\">Use <em>one</em>.</div></div>\n"
+
+	migrated, count := MigrateNotes([]byte(markdown))
+	expected := "Before\n\n" +
+		"!!! note\n" +
+		"    The **$mod** operator cannot use an index.\n\n" +
+		"    Avoid it.\n\n" +
+		"!!! note \"Indexes\"\n" +
+		"    Use *one*.\n"
+
+	if count != 2 {
+		t.Errorf("expected 2 notes got %d", count)
+	}
+
+	if string(migrated) != expected {
+		t.Errorf("expected %q got %q", expected, string(migrated))
+	}
+}
@@ -0,0 +1,210 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// The name of the manifest file in the output directory
+const ManifestFile = ".gutenberg-manifest.json"
+
+// Bumped whenever the layout of the manifest changes
+const manifestVersion = 1
+
+// What a page was generated from
+type PageEntry struct {
+	// The file the page was written to, relative to the output directory
+	Output string `json:"output"`
+	// Content hashes of the input files, relative to the source directory
+	Files map[string]string `json:"files"`
+	// Anything else the page depends on, e.g. the renderer version
+	Keys map[string]string `json:"keys"`
+	// Set when part of the page was rendered in a fallback form, e.g. a
+	// diagram without its renderer, so the next build generates it again
+	Incomplete bool `json:"incomplete,omitempty"`
+}
+
+// Records the inputs of every generated page so a build can skip
+// the pages whose inputs did not change
+type Manifest struct {
+	Version int                   `json:"version"`
+	Pages   map[string]*PageEntry `json:"pages"`
+
+	// Where we read the manifest from
+	outputDirectory string
+	// The source files are relative to this directory
+	root string
+	// Hashes computed during this build
+	hashes map[string]string
+	lock   sync.Mutex
+}
+
+// Read the manifest from the output directory, a missing or unreadable
+// manifest is an empty one so everything gets generated
+func LoadManifest(outputDirectory string, root string) *Manifest {
+	m := &Manifest{Version: manifestVersion,
+		Pages:           make(map[string]*PageEntry),
+		outputDirectory: outputDirectory,
+		root:            root,
+		hashes:          make(map[string]string),
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(outputDirectory, ManifestFile))
+	if err != nil {
+		return m
+	}
+
+	stored := &Manifest{}
+	err = json.Unmarshal(data, stored)
+	if err != nil || stored.Version != manifestVersion || stored.Pages == nil {
+		return m
+	}
+
+	m.Pages = stored.Pages
+	return m
+}
+
+// Write the manifest back to the output directory
+func (m *Manifest) Save() error {
+	m.lock.Lock()
+	data, err := json.MarshalIndent(m, "", "  ")
+	m.lock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(m.outputDirectory, ManifestFile), data, 0644)
+}
+
+// Returns the content hash of a file relative to the source directory,
+// every file is only hashed once per build
+func (m *Manifest) Hash(file string) (string, error) {
+	file = filepath.ToSlash(filepath.Clean(file))
+
+	m.lock.Lock()
+	hash, ok := m.hashes[file]
+	m.lock.Unlock()
+	if ok {
+		return hash, nil
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(m.root, filepath.FromSlash(file)))
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+	hash = hex.EncodeToString(sum[:])
+
+	m.lock.Lock()
+	m.hashes[file] = hash
+	m.lock.Unlock()
+	return hash, nil
+}
+
+// Returns the hash of a file or an empty hash for a file that does not exist,
+// a page including a missing file is regenerated once the file is created
+func (m *Manifest) fileHash(file string) (string, error) {
+	hash, err := m.Hash(file)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+
+	return hash, err
+}
+
+// Returns true if the page was generated before from exactly the same
+// files and keys and its output is still there
+func (m *Manifest) UpToDate(page string, keys map[string]string) bool {
+	m.lock.Lock()
+	entry := m.Pages[page]
+	m.lock.Unlock()
+	if entry == nil || entry.Incomplete {
+		return false
+	}
+
+	if len(entry.Keys) != len(keys) {
+		return false
+	}
+
+	for name, value := range keys {
+		if entry.Keys[name] != value {
+			return false
+		}
+	}
+
+	_, err := os.Stat(filepath.Join(m.outputDirectory, filepath.FromSlash(entry.Output)))
+	if err != nil {
+		return false
+	}
+
+	for file, recorded := range entry.Files {
+		hash, err := m.fileHash(file)
+		if err != nil || hash != recorded {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Record what a page was generated from
+func (m *Manifest) Record(page string, output string, files []string, keys map[string]string) error {
+	return m.record(page, output, files, keys, false)
+}
+
+// Record what a page was generated from when part of it was rendered in a
+// fallback form, the page keeps its dependents but is never up to date
+func (m *Manifest) RecordIncomplete(page string, output string, files []string, keys map[string]string) error {
+	return m.record(page, output, files, keys, true)
+}
+
+func (m *Manifest) record(page string, output string, files []string, keys map[string]string, incomplete bool) error {
+	entry := &PageEntry{Output: filepath.ToSlash(output),
+		Files:      make(map[string]string),
+		Keys:       make(map[string]string),
+		Incomplete: incomplete,
+	}
+
+	for _, file := range files {
+		hash, err := m.fileHash(file)
+		if err != nil {
+			return err
+		}
+
+		entry.Files[filepath.ToSlash(filepath.Clean(file))] = hash
+	}
+
+	for name, value := range keys {
+		entry.Keys[name] = value
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.Pages[page] = entry
+	return nil
+}
+
+// Returns the pages that were generated from a file relative to the source directory
+func (m *Manifest) Dependents(file string) []string {
+	file = filepath.ToSlash(filepath.Clean(file))
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	pages := make([]string, 0)
+	for page, entry := range m.Pages {
+		if _, ok := entry.Files[file]; ok {
+			pages = append(pages, page)
+		}
+	}
+
+	sort.Strings(pages)
+	return pages
+}
@@ -0,0 +1,168 @@
+package cache
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+/**
+ * Tests
+ **/
+func TestManifest(t *testing.T) {
+	root, err := ioutil.TempDir("", "gutenberg-cache")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	defer os.RemoveAll(root)
+
+	output := filepath.Join(root, "output")
+	os.Mkdir(output, 0755)
+	os.Mkdir(filepath.Join(root, "code"), 0755)
+	ioutil.WriteFile(filepath.Join(root, "ex0.md"), []byte("# Exercise 0"), 0644)
+	ioutil.WriteFile(filepath.Join(root, "code", "ex1.js"), []byte("var a = 1;"), 0644)
+
+	keys := map[string]string{"version": "1"}
+	m := LoadManifest(output, root)
+	if m.UpToDate("ex0.md", keys) {
+		t.Errorf("an empty manifest has no pages")
+	}
+
+	// Record the page and write the manifest out
+	ioutil.WriteFile(filepath.Join(output, "ex0.html"), []byte("<h1>Exercise 0</h1>"), 0644)
+	err = m.Record("ex0.md", "ex0.html", []string{"ex0.md", "code/ex1.js"}, keys)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+
+	err = m.Save()
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+
+	m = LoadManifest(output, root)
+	if !m.UpToDate("ex0.md", keys) {
+		t.Errorf("expected the page to be up to date")
+	}
+
+	if m.UpToDate("ex0.md", map[string]string{"version": "2"}) {
+		t.Errorf("expected a new renderer version to regenerate the page")
+	}
+
+	// Same modification time but different content
+	info, _ := os.Stat(filepath.Join(root, "code", "ex1.js"))
+	ioutil.WriteFile(filepath.Join(root, "code", "ex1.js"), []byte("var b = 2;"), 0644)
+	os.Chtimes(filepath.Join(root, "code", "ex1.js"), info.ModTime(), info.ModTime())
+
+	m = LoadManifest(output, root)
+	if m.UpToDate("ex0.md", keys) {
+		t.Errorf("expected a changed include to regenerate the page")
+	}
+
+	// A removed output is regenerated
+	ioutil.WriteFile(filepath.Join(root, "code", "ex1.js"), []byte("var a = 1;"), 0644)
+	os.Remove(filepath.Join(output, "ex0.html"))
+	m = LoadManifest(output, root)
+	if m.UpToDate("ex0.md", keys) {
+		t.Errorf("expected a missing output to regenerate the page")
+	}
+}
+
+func TestDependents(t *testing.T) {
+	root, err := ioutil.TempDir("", "gutenberg-cache")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	defer os.RemoveAll(root)
+
+	os.Mkdir(filepath.Join(root, "code"), 0755)
+	for _, file := range []string{"ex0.md", "ex1.md", "code/ex1.js"} {
+		ioutil.WriteFile(filepath.Join(root, file), []byte(file), 0644)
+	}
+
+	m := LoadManifest(root, root)
+	m.Record("ex0.md", "ex0.html", []string{"ex0.md", "code/ex1.js"}, nil)
+	m.Record("ex1.md", "ex1.html", []string{"ex1.md", "code/ex1.js"}, nil)
+
+	pages := m.Dependents("./code/ex1.js")
+	if len(pages) != 2 || pages[0] != "ex0.md" || pages[1] != "ex1.md" {
+		t.Errorf("expected both pages to depend on code/ex1.js got %v", pages)
+	}
+
+	pages = m.Dependents("ex1.md")
+	if len(pages) != 1 || pages[0] != "ex1.md" {
+		t.Errorf("expected only ex1.md to depend on itself got %v", pages)
+	}
+}
+
+func TestMissingInclude(t *testing.T) {
+	root, err := ioutil.TempDir("", "gutenberg-cache")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	defer os.RemoveAll(root)
+
+	ioutil.WriteFile(filepath.Join(root, "ex0.md"), []byte("# Exercise 0"), 0644)
+	ioutil.WriteFile(filepath.Join(root, "ex0.html"), []byte("<h1>Exercise 0</h1>"), 0644)
+
+	m := LoadManifest(root, root)
+	err = m.Record("ex0.md", "ex0.html", []string{"ex0.md", "code/ex1.js"}, nil)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+
+	if pages := m.Dependents("code/ex1.js"); len(pages) != 1 || pages[0] != "ex0.md" {
+		t.Errorf("expected the page to depend on the missing include got %v", pages)
+	}
+
+	if !m.UpToDate("ex0.md", nil) {
+		t.Errorf("expected the page to be up to date while the include is missing")
+	}
+
+	err = m.Save()
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+
+	// Creating the include regenerates the page
+	os.Mkdir(filepath.Join(root, "code"), 0755)
+	ioutil.WriteFile(filepath.Join(root, "code", "ex1.js"), []byte("var a = 1;"), 0644)
+	m = LoadManifest(root, root)
+	if m.UpToDate("ex0.md", nil) {
+		t.Errorf("expected a created include to regenerate the page")
+	}
+}
+
+func TestIncompletePage(t *testing.T) {
+	root, err := ioutil.TempDir("", "gutenberg-cache")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	defer os.RemoveAll(root)
+
+	os.Mkdir(filepath.Join(root, "code"), 0755)
+	for _, file := range []string{"ex15.md", "ex15.html", "code/ex2.dot"} {
+		ioutil.WriteFile(filepath.Join(root, file), []byte(file), 0644)
+	}
+
+	m := LoadManifest(root, root)
+	err = m.RecordIncomplete("ex15.md", "ex15.html", []string{"ex15.md", "code/ex2.dot"}, nil)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+
+	err = m.Save()
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+
+	m = LoadManifest(root, root)
+	if m.UpToDate("ex15.md", nil) {
+		t.Errorf("expected an incomplete page to be generated again")
+	}
+
+	if pages := m.Dependents("code/ex2.dot"); len(pages) != 1 || pages[0] != "ex15.md" {
+		t.Errorf("expected the incomplete page to depend on its diagram got %v", pages)
+	}
+}
@@ -1,22 +1,48 @@
 package config
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"strings"
 )
 
 func init() {
 }
 
 type Layout struct {
-	Index string
-	Page  string
+	Index string `json:"index"`
+	Page  string `json:"page"`
+}
+
+type Book struct {
+	Title       string `json:"title"`
+	Subtitle    string `json:"subtitle"`
+	Author      string `json:"author"`
+	Description string `json:"description"`
+	Language    string `json:"language"`
+	// Unique id of the book for the epub, defaults to one made from the title
+	Identifier string `json:"identifier"`
 }
 
 type TableOfContentsEntry struct {
 	File string `json:"file"`
+	// Overrides the title taken from the first header of the page
+	Title string `json:"title"`
+}
+
+// Returns the name of the file a page is rendered to, e.g. ex0.html for ex0.md
+func (entry TableOfContentsEntry) OutputName() string {
+	// Split the file up so we can get the "name"
+	fileNameParts := strings.Split(entry.File, ".")
+	if len(fileNameParts) == 1 {
+		return entry.File + ".html"
+	}
+
+	return strings.Join(fileNameParts[0:(len(fileNameParts)-1)], ".") + ".html"
 }
 
 type IndexEntry struct {
@@ -26,20 +52,34 @@ type IndexEntry struct {
 
 type HTMLIndex struct {
 	Entries []IndexEntry `json:"entries"`
+	// Layout to render the index with into its own page
+	Layout string `json:"layout"`
+	// The page the index is rendered to, defaults to <name>.html
+	Output string `json:"output"`
 }
 
 type Index struct {
-	HTML HTMLIndex
+	HTML HTMLIndex `json:"html"`
 }
 
 type Config struct {
-	OutputDirectory     string                 `json:"output_directory"`
+	Book            Book   `json:"book"`
+	OutputDirectory string `json:"output_directory"`
+	// Comma separated formats to build, e.g. "html,epub"
 	DefaultOutputFormat string                 `json:"default_output_format"`
 	TableOfContents     []TableOfContentsEntry `json:"table_of_contents"`
 	Layouts             map[string]Layout      `json:"layouts"`
 	SourcePath          string                 `json:"source_path"`
 	Indexes             map[string]Index       `json:"indexes"`
 	Assets              []string               `json:"assets"`
+	HighlightTheme      string                 `json:"highlight_theme"`
+	// The number of the first chapter in the table of contents
+	FirstChapter int `json:"first_chapter"`
+	// File with the LaTeX preamble of the latex format
+	LatexPreamble string `json:"latex_preamble"`
+	// Command that reads a Graphviz diagram on stdin and writes it as svg,
+	// the default is dot -Tsvg
+	DiagramCommand string `json:"diagram_command"`
 }
 
 func SourcePath(source *string) string {
@@ -74,12 +114,57 @@ func ReadConfigFromFile(cfgfile *string, source *string) (*Config, error) {
 
 	// Allocate config
 	c := &Config{}
-	// Convert bytes to json
-	json.Unmarshal(data, c)
+	// Convert bytes to json, keys we do not know are most likely typos
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(c)
 	if err != nil {
-		return nil, err
+		return nil, describeError(configFile, data, err)
+	}
+
+	// Anything after the configuration is most likely left over from a merge
+	end := decoder.InputOffset()
+	var extra json.RawMessage
+	if err = decoder.Decode(&extra); err != io.EOF {
+		rest := data[end:]
+		line, column := position(data, end+int64(len(rest)-len(bytes.TrimLeft(rest, " \t\r\n"))))
+		return nil, fmt.Errorf("%s:%d:%d: unexpected content after the configuration", configFile, line, column)
 	}
 
 	// Return the parsed config file
 	return c, nil
 }
+
+// Adds the file and for syntax and type errors the line and column to a
+// decoding error
+func describeError(configFile string, data []byte, err error) error {
+	var offset int64
+	switch e := err.(type) {
+	case *json.SyntaxError:
+		offset = e.Offset
+	case *json.UnmarshalTypeError:
+		offset = e.Offset
+	default:
+		return fmt.Errorf("%s: %v", configFile, err)
+	}
+
+	// The offset is just past the byte the error is about
+	line, column := position(data, offset-1)
+	return fmt.Errorf("%s:%d:%d: %v", configFile, line, column, err)
+}
+
+// Returns the line and column of an offset into the data
+func position(data []byte, offset int64) (int, int) {
+	if offset < 0 {
+		offset = 0
+	}
+
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := len(before) - bytes.LastIndex(before, []byte("\n"))
+	return line, column
+}
@@ -0,0 +1,105 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func writeBook(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "gutenberg-config")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+
+	for name, content := range files {
+		err = ioutil.WriteFile(dir+"/"+name, []byte(content), 0644)
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+	}
+
+	return dir
+}
+
+/**
+ * Tests
+ **/
+func TestSyntaxErrorPosition(t *testing.T) {
+	dir := writeBook(t, map[string]string{"config.json": "{\n\t\"output_directory\": \"./output\",\n\t\"assets\": [,]\n}"})
+	defer os.RemoveAll(dir)
+
+	cfgfile := ""
+	_, err := ReadConfigFromFile(&cfgfile, &dir)
+	if err == nil || !strings.Contains(err.Error(), "config.json:3:13:") {
+		t.Errorf("expected the line and column of the error got %v", err)
+	}
+}
+
+func TestUnknownKey(t *testing.T) {
+	dir := writeBook(t, map[string]string{"config.json": "{\"output_directroy\": \"./output\"}"})
+	defer os.RemoveAll(dir)
+
+	cfgfile := ""
+	_, err := ReadConfigFromFile(&cfgfile, &dir)
+	if err == nil || !strings.Contains(err.Error(), "output_directroy") {
+		t.Errorf("expected the unknown key to be rejected got %v", err)
+	}
+}
+
+func TestTrailingContent(t *testing.T) {
+	tests := map[string]string{
+		"\n{\"assets\": []}\n":   "config.json:2:1:",
+		"\n\n  >>>>>>> theirs\n": "config.json:3:3:",
+	}
+
+	for trailing, expected := range tests {
+		dir := writeBook(t, map[string]string{"config.json": "{\"output_directory\": \"./output\"}" + trailing})
+		defer os.RemoveAll(dir)
+
+		cfgfile := ""
+		_, err := ReadConfigFromFile(&cfgfile, &dir)
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected the content after the configuration at %s got %v", expected, err)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	dir := writeBook(t, map[string]string{
+		"config.json": `{
+			"table_of_contents": [{"file": "ex0.md"}, {"file": "ex1.md"}],
+			"layouts": {"html": {"index": "index.gtl", "page": "page.gtl"}},
+			"indexes": {"chapters": {"html": {"entries": [{"file": "ex0.html"}, {"file": "ex9.html"}]}}},
+			"assets": ["page.css"]
+		}`,
+		"ex0.md":    "Exercise 0\n",
+		"index.gtl": "",
+	})
+	defer os.RemoveAll(dir)
+
+	cfgfile := ""
+	c, err := ReadConfigFromFile(&cfgfile, &dir)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+
+	problems := Validate(c, dir)
+	expected := []string{
+		"table_of_contents file ex1.md does not exist",
+		"html layout page.gtl does not exist",
+		"asset page.css does not exist",
+		"chapters index entry ex9.html is not a page of the book",
+	}
+
+	if len(problems) != len(expected) {
+		t.Fatalf("expected %d problems got %v", len(expected), problems)
+	}
+
+	for i, problem := range problems {
+		if problem.Error() != expected[i] {
+			t.Errorf("expected [%s] got [%s]", expected[i], problem)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+// Returns a problem for every file the configuration refers to that does not
+// exist in the source directory
+func Validate(c *Config, sourcePath string) []error {
+	problems := make([]error, 0)
+	exists := func(file string) bool {
+		_, err := os.Stat(fmt.Sprintf("%s/%s", sourcePath, file))
+		return err == nil
+	}
+
+	if len(c.TableOfContents) == 0 {
+		problems = append(problems, fmt.Errorf("table_of_contents has no entries"))
+	}
+
+	// The pages of the book and the files they are rendered to
+	outputs := make(map[string]bool)
+	for i, page := range c.TableOfContents {
+		if page.File == "" {
+			problems = append(problems, fmt.Errorf("table_of_contents entry %d has no file", i))
+			continue
+		}
+
+		if !exists(page.File) {
+			problems = append(problems, fmt.Errorf("table_of_contents file %s does not exist", page.File))
+		}
+
+		outputs[page.OutputName()] = true
+	}
+
+	// Go through the formats in order so the problems are reported the same
+	// way every time
+	formats := make([]string, 0, len(c.Layouts))
+	for format := range c.Layouts {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+
+	for _, format := range formats {
+		layout := c.Layouts[format]
+		for _, file := range []string{layout.Index, layout.Page} {
+			if file != "" && !exists(file) {
+				problems = append(problems, fmt.Errorf("%s layout %s does not exist", format, file))
+			}
+		}
+	}
+
+	for _, asset := range c.Assets {
+		if !exists(asset) {
+			problems = append(problems, fmt.Errorf("asset %s does not exist", asset))
+		}
+	}
+
+	if c.LatexPreamble != "" && !exists(c.LatexPreamble) {
+		problems = append(problems, fmt.Errorf("latex preamble %s does not exist", c.LatexPreamble))
+	}
+
+	names := make([]string, 0, len(c.Indexes))
+	for name := range c.Indexes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		index := c.Indexes[name].HTML
+		if index.Layout != "" && !exists(index.Layout) {
+			problems = append(problems, fmt.Errorf("%s index layout %s does not exist", name, index.Layout))
+		}
+
+		// Entries point at the rendered pages or at files copied over as is
+		for _, entry := range index.Entries {
+			if !outputs[entry.File] && !exists(entry.File) {
+				problems = append(problems, fmt.Errorf("%s index entry %s is not a page of the book", name, entry.File))
+			}
+		}
+	}
+
+	return problems
+}
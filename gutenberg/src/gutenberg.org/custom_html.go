@@ -2,18 +2,25 @@ package gutenberg
 
 import (
 	"bytes"
-	"encoding/json"
 	"fmt"
 	blackfriday "github.com/russross/blackfriday"
 	"gutenberg.org/config"
-	"io/ioutil"
+	"gutenberg.org/highlight"
+	"html"
 	"log"
-	"os/exec"
 	"strings"
 )
 
+// Bumped whenever the rendered output changes so cached pages are regenerated
+const Version = "0.5.2"
+
 type MarkdownTransformer interface {
 	Transform([]byte) []byte
+	// Files the transformed input included, relative to the source path
+	Dependencies() []string
+	// False if part of the input was rendered in a fallback form, e.g. a
+	// diagram without its renderer, the output should not be kept as final
+	Complete() bool
 }
 
 type CustomMarkdownTransformer struct {
@@ -22,19 +29,95 @@ type CustomMarkdownTransformer struct {
 }
 
 func (p *CustomMarkdownTransformer) Transform(input []byte) []byte {
-	return blackfriday.Markdown(input, p.renderer, p.extensions)
+	return blackfriday.Markdown(prepareMarkdown(input), p.renderer, p.extensions)
+}
+
+func (p *CustomMarkdownTransformer) Dependencies() []string {
+	if tracker, ok := p.renderer.(dependencyTracker); ok {
+		return tracker.Dependencies()
+	}
+
+	return nil
+}
+
+func (p *CustomMarkdownTransformer) Complete() bool {
+	if tracker, ok := p.renderer.(completenessTracker); ok {
+		return tracker.Complete()
+	}
+
+	return true
 }
 
-func NewCustomHtml(c *config.Config) MarkdownTransformer {
-	// set up the HTML renderer
-	htmlFlags := 0
-	htmlFlags |= blackfriday.HTML_USE_XHTML
-	htmlFlags |= blackfriday.HTML_USE_SMARTYPANTS
-	htmlFlags |= blackfriday.HTML_SMARTYPANTS_FRACTIONS
-	htmlFlags |= blackfriday.HTML_SMARTYPANTS_LATEX_DASHES
-	htmlFlags |= blackfriday.HTML_SKIP_SCRIPT
+// Turn the syntax blackfriday does not know into markdown it does before the
+// markdown is parsed
+func prepareMarkdown(input []byte) []byte {
+	return expandReferences(quoteFenceParameters(ExpandAdmonitions(input)))
+}
+
+// Implemented by renderers that read other files while rendering
+type dependencyTracker interface {
+	Dependencies() []string
+}
+
+// Implemented by renderers that can fall back to a lesser rendering
+type completenessTracker interface {
+	Complete() bool
+}
+
+// Create a markdown to html transformer, everything it has to say is written
+// to the logger so pages rendered in parallel can keep their output apart
+func NewCustomHtml(c *config.Config, logger *log.Logger) MarkdownTransformer {
+	return newCustomHtml(c, logger, "", "", nil, nil)
+}
+
+// Create a markdown to html transformer for a page of the book rendered to
+// its own file, references resolve to the labels and the figures and listings
+// are numbered with the chapter of the page
+func NewPageHtml(c *config.Config, logger *log.Logger, page string, labels *Labels) MarkdownTransformer {
+	return newCustomHtml(c, logger, page, "", nil, labels)
+}
 
-	// set up the parser
+// Create a markdown to html transformer for a page of the single page book,
+// pages are the files every page of the book is rendered to. Heading ids are
+// prefixed with the section of the page so they stay unique in the book and
+// links between the pages point to their sections.
+func NewSinglePageHtml(c *config.Config, logger *log.Logger, page string, pages []string, labels *Labels) MarkdownTransformer {
+	sections := make(map[string]string)
+	for _, other := range pages {
+		sections[other] = SectionId(other)
+	}
+
+	return newCustomHtml(c, logger, page, SectionId(page), sections, labels)
+}
+
+func newCustomHtml(c *config.Config, logger *log.Logger, page string, section string, sections map[string]string, labels *Labels) MarkdownTransformer {
+	if logger == nil {
+		logger = log.New(log.Writer(), log.Prefix(), log.Flags())
+	}
+
+	// Wrap up everything
+	htmlRenderer := blackfriday.HtmlRenderer(htmlFlags(), "", "")
+	customRenderer := &CustomHtml{html: htmlRenderer,
+		codeIncluder: codeIncluder{config: c, logger: logger},
+		headingIds:   newHeadingIds(section, sections),
+		pageLabels:   pageLabels{labels: labels, page: page},
+	}
+	return &CustomMarkdownTransformer{renderer: customRenderer, extensions: markdownExtensions()}
+}
+
+// The flags of the blackfriday html renderer
+func htmlFlags() int {
+	flags := 0
+	flags |= blackfriday.HTML_USE_XHTML
+	flags |= blackfriday.HTML_USE_SMARTYPANTS
+	flags |= blackfriday.HTML_SMARTYPANTS_FRACTIONS
+	flags |= blackfriday.HTML_SMARTYPANTS_LATEX_DASHES
+	flags |= blackfriday.HTML_SKIP_SCRIPT
+	return flags
+}
+
+// The markdown extensions every renderer parses with
+func markdownExtensions() int {
 	extensions := 0
 	extensions |= blackfriday.EXTENSION_NO_INTRA_EMPHASIS
 	extensions |= blackfriday.EXTENSION_TABLES
@@ -42,98 +125,92 @@ func NewCustomHtml(c *config.Config) MarkdownTransformer {
 	extensions |= blackfriday.EXTENSION_AUTOLINK
 	extensions |= blackfriday.EXTENSION_STRIKETHROUGH
 	extensions |= blackfriday.EXTENSION_SPACE_HEADERS
-
-	// Wrap up everything
-	htmlRenderer := blackfriday.HtmlRenderer(htmlFlags, "", "")
-	customRenderer := &CustomHtml{html: htmlRenderer, config: c}
-	return &CustomMarkdownTransformer{renderer: customRenderer, extensions: extensions}
+	return extensions
 }
 
 type CustomHtml struct {
-	html   blackfriday.Renderer
-	config *config.Config
+	html blackfriday.Renderer
+	codeIncluder
+	headingIds
+	pageLabels
+	// Set once a diagram was shown as its source
+	fallback bool
 }
 
-type langParameters struct {
-	File   string `json:"file"`
-	Indent int    `json:"indent"`
+func (p *CustomHtml) Complete() bool {
+	return !p.fallback
 }
 
-func executeSourceHighlight(lang string, text []byte, c *config.Config) ([]byte, error) {
-	var source []byte
-
-	// Check if we have additional parameters
-	if strings.Index(lang, "{") != -1 {
-		// Unpack the parameters
-		paramsString := lang[strings.Index(lang, "{"):]
-		lang = lang[0:strings.Index(lang, "{")]
-		params := &langParameters{}
-		// Deserialize the values
-		err := json.Unmarshal([]byte(paramsString), params)
-		if err != nil {
-			log.Printf("configuration %s is not a valid json object\n", paramsString)
-			return nil, err
-		}
+func (p *CustomHtml) BlockCode(out *bytes.Buffer, text []byte, lang string) {
+	doubleSpace(out)
 
-		// Get the right path to the filename
-		fileName := fmt.Sprintf("%s/%s", c.SourcePath, params.File)
-		log.Printf("Read source from file %s\n", fileName)
-		// Read the file in
-		source, err = ioutil.ReadFile(fileName)
-		if err != nil {
-			return nil, err
-		}
-	} else {
-		source = text
+	if params, ok := admonition(lang); ok {
+		out.WriteString("<div class=\"admonition ")
+		attrEscape(out, []byte(params.Type))
+		out.WriteString("\">\n<div class=\"admonition_title\">")
+		attrEscape(out, []byte(params.Title))
+		out.WriteString("</div>\n<div class=\"admonition_body\">\n")
+		out.Write(renderAdmonitionBody(p, text))
+		out.WriteString("</div>\n</div>\n")
+		return
 	}
 
-	// Set up the temp file names
-	tempFileNameIn := fmt.Sprintf("%s/%s.%s", c.OutputDirectory, "temp", lang)
-	tempFileNameOut := fmt.Sprintf("%s/%s.%s", c.OutputDirectory, "temp", "html")
-
-	// Write the file out first
-	err := ioutil.WriteFile(tempFileNameIn, source, 0755)
+	// Get the code we are rendering
+	lang, params, source, err := p.blockSource(lang, text)
 	if err != nil {
-		return nil, err
+		p.logger.Printf("failed to include source for code block: %v\n", err)
 	}
 
-	// Make sure we have the tool available
-	_, err = exec.LookPath("source-highlight")
-	if err != nil {
-		return nil, err
+	// Figures and listings are counted even if their source is missing so
+	// the numbers stay the ones the references were given
+	kind := blockKind(lang, params)
+	number := ""
+	if kind != "" {
+		number = p.nextNumber(kind)
 	}
 
-	// Format the code using gnu source-highlight
-	cmd := exec.Command("source-highlight",
-		"-s",
-		lang,
-		"-f",
-		"html",
-		"--input",
-		tempFileNameIn,
-		"--output",
-		tempFileNameOut,
-	)
-	// Start the command
-	err = cmd.Start()
-	// Wait for process to finish
-	err = cmd.Wait()
-	if err != nil {
-		return nil, err
+	if err == nil && isDiagram(lang) {
+		p.diagram(out, lang, params, number, source)
+		return
 	}
 
-	// Read the converted file
-	html, err := ioutil.ReadFile(tempFileNameOut)
-	if err != nil {
-		return nil, err
+	if kind == "" {
+		p.code(out, lang, source)
+		return
 	}
 
-	return html, nil
+	// Code blocks with a label or a caption are listings
+	out.WriteString("<figure class=\"listing\"")
+	p.writeLabelId(out, params.Label)
+	out.WriteString(">\n")
+	p.code(out, lang, source)
+	p.caption(out, kind, number, params.Caption)
+	out.WriteString("</figure>\n")
+}
+
+// Write the id attribute of a labeled element
+func (p *CustomHtml) writeLabelId(out *bytes.Buffer, label string) {
+	if label != "" {
+		out.WriteString(" id=\"")
+		attrEscape(out, []byte(p.labelId(label)))
+		out.WriteString("\"")
+	}
 }
 
-func (p *CustomHtml) BlockCode(out *bytes.Buffer, text []byte, lang string) {
-	doubleSpace(out)
+// Write the caption of a figure or listing with its number
+func (p *CustomHtml) caption(out *bytes.Buffer, kind string, number string, caption string) {
+	text := captionText(kind, number, caption)
+	if text == "" {
+		return
+	}
+
+	out.WriteString("<figcaption>")
+	attrEscape(out, []byte(text))
+	out.WriteString("</figcaption>\n")
+}
 
+// Write the highlighted source of a code block
+func (p *CustomHtml) code(out *bytes.Buffer, lang string, source []byte) {
 	// parse out the language names/classes
 	count := 0
 	for _, elt := range strings.Fields(lang) {
@@ -144,7 +221,7 @@ func (p *CustomHtml) BlockCode(out *bytes.Buffer, text []byte, lang string) {
 			continue
 		}
 		if count == 0 {
-			out.WriteString("<pre><code class=\"")
+			out.WriteString("<pre class=\"highlight\"><code class=\"")
 		} else {
 			out.WriteByte(' ')
 		}
@@ -153,21 +230,39 @@ func (p *CustomHtml) BlockCode(out *bytes.Buffer, text []byte, lang string) {
 	}
 
 	if count == 0 {
-		out.WriteString("<pre><code>")
+		out.WriteString("<pre class=\"highlight\"><code>")
 	} else {
 		out.WriteString("\">")
 	}
 
-	if lang == "console" {
-		attrEscape(out, text)
-	} else if lang != "" {
-		html, _ := executeSourceHighlight(lang, text, p.config)
-		out.Write(html)
-	}
+	// Languages we have no lexer for are rendered as plain text
+	html, _ := highlight.Highlight(strings.TrimSpace(lang), source)
+	out.Write(html)
 
 	out.WriteString("</code></pre>\n")
 }
 
+// Write a diagram as a figure with the svg inlined, a diagram that can not be
+// rendered shows its source instead
+func (p *CustomHtml) diagram(out *bytes.Buffer, lang string, params *langParameters, number string, source []byte) {
+	out.WriteString("<figure class=\"diagram\"")
+	p.writeLabelId(out, params.Label)
+	out.WriteString(">\n")
+
+	svg, err := RenderDiagram(p.config, source)
+	if err != nil {
+		p.logger.Printf("warning: failed to render diagram, showing its source instead: %v\n", err)
+		p.fallback = true
+		p.code(out, lang, source)
+	} else {
+		out.Write(svg)
+		out.WriteByte('\n')
+	}
+
+	p.caption(out, "figure", number, params.Caption)
+	out.WriteString("</figure>\n")
+}
+
 func (p *CustomHtml) BlockQuote(out *bytes.Buffer, text []byte) {
 	p.html.BlockQuote(out, text)
 }
@@ -177,7 +272,30 @@ func (p *CustomHtml) BlockHtml(out *bytes.Buffer, text []byte) {
 }
 
 func (p *CustomHtml) Header(out *bytes.Buffer, text func() bool, level int) {
-	p.html.Header(out, text, level)
+	marker := out.Len()
+	doubleSpace(out)
+
+	// Render the text first, the id is made from it
+	start := out.Len()
+	if !text() {
+		out.Truncate(marker)
+		return
+	}
+
+	content, label := splitLabel(append([]byte(nil), out.Bytes()[start:]...))
+	out.Truncate(start)
+
+	// A labeled heading has the label as its id
+	var id string
+	if label != "" {
+		id = p.labelId(label)
+	} else {
+		id = p.headingId(content)
+	}
+
+	out.WriteString(fmt.Sprintf("<h%d id=\"%s\">", level, id))
+	out.Write(content)
+	out.WriteString(fmt.Sprintf("</h%d>\n", level))
 }
 
 func (p *CustomHtml) HRule(out *bytes.Buffer) {
@@ -241,7 +359,18 @@ func (p *CustomHtml) LineBreak(out *bytes.Buffer) {
 }
 
 func (p *CustomHtml) Link(out *bytes.Buffer, link []byte, title []byte, content []byte) {
-	p.html.Link(out, link, title, content)
+	if name, ok := referenceName(link); ok {
+		target, text := p.reference(name, string(content), html.EscapeString)
+		if target == "" {
+			p.logger.Printf("reference to unknown label %s\n", name)
+			out.WriteString(text)
+			return
+		}
+
+		link, content = []byte(target), []byte(text)
+	}
+
+	p.html.Link(out, p.rewriteLink(link), title, content)
 }
 
 func (p *CustomHtml) RawHtmlTag(out *bytes.Buffer, tag []byte) {
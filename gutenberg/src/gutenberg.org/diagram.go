@@ -0,0 +1,79 @@
+package gutenberg
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"gutenberg.org/config"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// The command diagrams are rendered with when the config has none, it reads
+// the Graphviz source on stdin and writes the svg to stdout
+const DefaultDiagramCommand = "dot -Tsvg"
+
+// The directory in the output directory rendered diagrams are cached in
+const DiagramCache = ".gutenberg-diagrams"
+
+// Code blocks in these languages are Graphviz diagrams
+func isDiagram(lang string) bool {
+	switch strings.ToLower(strings.TrimSpace(lang)) {
+	case "dot", "graph":
+		return true
+	}
+
+	return false
+}
+
+// Render Graphviz source to svg with the diagram command of the config. The
+// svg is cached by the hash of the command and the source so a diagram is
+// only rendered again when it changes.
+func RenderDiagram(c *config.Config, source []byte) ([]byte, error) {
+	command := c.DiagramCommand
+	if command == "" {
+		command = DefaultDiagramCommand
+	}
+
+	sum := sha256.Sum256(append([]byte(command+"\n"), source...))
+	cacheFile := filepath.Join(c.OutputDirectory, DiagramCache, hex.EncodeToString(sum[:])+".svg")
+	if svg, err := ioutil.ReadFile(cacheFile); err == nil {
+		return svg, nil
+	}
+
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil, fmt.Errorf("the diagram command is empty")
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = bytes.NewReader(source)
+	stderr := bytes.NewBuffer(nil)
+	cmd.Stderr = stderr
+	output, err := cmd.Output()
+	if err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return nil, fmt.Errorf("%s: %v: %s", command, err, message)
+		}
+
+		return nil, fmt.Errorf("%s: %v", command, err)
+	}
+
+	// Leave out the xml declaration and doctype so the svg can be inlined
+	start := bytes.Index(output, []byte("<svg"))
+	if start == -1 {
+		return nil, fmt.Errorf("%s did not write an svg", command)
+	}
+	svg := bytes.TrimSpace(output[start:])
+
+	// A diagram that could not be cached is just rendered again next time
+	if err := os.MkdirAll(filepath.Dir(cacheFile), 0755); err == nil {
+		ioutil.WriteFile(cacheFile, svg, 0644)
+	}
+
+	return svg, nil
+}
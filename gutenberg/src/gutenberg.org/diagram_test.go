@@ -0,0 +1,79 @@
+package gutenberg
+
+import (
+	"gutenberg.org/config"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+/**
+ * Tests
+ **/
+func TestDiagram(t *testing.T) {
+	output, err := ioutil.TempDir("", "gutenberg-diagram")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	defer os.RemoveAll(output)
+
+	c := &config.Config{OutputDirectory: output, DiagramCommand: "echo <svg/>"}
+	markdown := "```dot{\"caption\": \"Documents & indexes\"}\ndigraph g { a -> b; }\n```\n"
+
+	transformer := NewCustomHtml(c, nil)
+	html := string(transformer.Transform([]byte(markdown)))
+	expected := "<figure class=\"diagram\">\n" +
+		"<svg/>\n" +
+		"<figcaption>Documents &amp; indexes</figcaption>\n" +
+		"</figure>\n"
+
+	if html != expected {
+		t.Errorf("expected %q got %q", expected, html)
+	}
+
+	if !transformer.Complete() {
+		t.Errorf("expected the page to be complete")
+	}
+
+	cached, err := filepath.Glob(filepath.Join(c.OutputDirectory, DiagramCache, "*.svg"))
+	if err != nil || len(cached) != 1 {
+		t.Fatalf("expected one cached diagram got %v", cached)
+	}
+
+	svg, _ := ioutil.ReadFile(cached[0])
+	if string(svg) != "<svg/>" {
+		t.Errorf("expected the svg to be cached got %q", string(svg))
+	}
+}
+
+func TestDiagramWithoutRenderer(t *testing.T) {
+	output, err := ioutil.TempDir("", "gutenberg-diagram")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	defer os.RemoveAll(output)
+
+	c := &config.Config{OutputDirectory: output, DiagramCommand: "gutenberg-missing-renderer -Tsvg"}
+	markdown := "```graph\ndigraph g { a -> b; }\n```\n"
+
+	transformer := NewCustomHtml(c, nil)
+	html := string(transformer.Transform([]byte(markdown)))
+	if !strings.HasPrefix(html, "<figure class=\"diagram\">\n<pre class=\"highlight\"><code class=\"graph\">") {
+		t.Errorf("expected the source of the diagram got %q", html)
+	}
+
+	if transformer.Complete() {
+		t.Errorf("expected a page with a diagram shown as its source not to be complete")
+	}
+}
+
+func TestPackParameters(t *testing.T) {
+	markdown := "```js{\"file\": \"a.js\", \"start_after\": \"var a = \\\"b c\\\"\"}\n```\n"
+	expected := "```js{\"file\":\"a.js\",\"start_after\":\"var\\u0020a\\u0020=\\u0020\\\"b\\u0020c\\\"\"}\n```\n"
+
+	if packed := string(quoteFenceParameters([]byte(markdown))); packed != expected {
+		t.Errorf("expected %q got %q", expected, packed)
+	}
+}
@@ -0,0 +1,265 @@
+package epub
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"path"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// A chapter of the book, the content is a complete XHTML document
+type Chapter struct {
+	// Name of the chapter in the book, e.g. ex0.html
+	File    string
+	Title   string
+	Content []byte
+}
+
+// Any other file of the book such as a stylesheet or an image
+type Resource struct {
+	File    string
+	Content []byte
+}
+
+type Book struct {
+	// Defaults to an id made from the title
+	Identifier  string
+	Title       string
+	Author      string
+	Description string
+	// Defaults to en
+	Language string
+	Modified time.Time
+	Chapters []Chapter
+	// Stylesheets are linked from the navigation document as well
+	Resources []Resource
+}
+
+// Named entities are not known to XML so they become numeric ones
+var entity = regexp.MustCompile(`&[a-zA-Z][a-zA-Z0-9]*;`)
+
+// Wrap rendered html into an XHTML document that links the stylesheets
+func Document(title string, body []byte, stylesheets []string, language string) []byte {
+	buffer := bytes.NewBuffer(nil)
+	buffer.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+	buffer.WriteString("<!DOCTYPE html>\n")
+	buffer.WriteString(fmt.Sprintf("<html xmlns=\"http://www.w3.org/1999/xhtml\" xmlns:epub=\"http://www.idpf.org/2007/ops\" xml:lang=\"%s\" lang=\"%s\">\n", escape(language), escape(language)))
+	buffer.WriteString("<head>\n<meta charset=\"utf-8\" />\n")
+	buffer.WriteString(fmt.Sprintf("<title>%s</title>\n", escape(title)))
+	for _, stylesheet := range stylesheets {
+		buffer.WriteString(fmt.Sprintf("<link rel=\"stylesheet\" type=\"text/css\" href=\"%s\" />\n", escape(stylesheet)))
+	}
+	buffer.WriteString("</head>\n<body>\n")
+	buffer.Write(XHTML(body))
+	buffer.WriteString("\n</body>\n</html>\n")
+	return buffer.Bytes()
+}
+
+// Replace the named entities html allows but XML does not
+func XHTML(content []byte) []byte {
+	return entity.ReplaceAllFunc(content, func(name []byte) []byte {
+		switch string(name) {
+		case "&amp;", "&lt;", "&gt;", "&quot;", "&apos;":
+			return name
+		}
+
+		text := html.UnescapeString(string(name))
+		if text == string(name) {
+			// Not an entity at all, escape the ampersand
+			return append([]byte("&amp;"), name[1:]...)
+		}
+
+		buffer := bytes.NewBuffer(nil)
+		for _, r := range text {
+			buffer.WriteString(fmt.Sprintf("&#%d;", r))
+		}
+
+		return buffer.Bytes()
+	})
+}
+
+type archiveFile struct {
+	name    string
+	content []byte
+}
+
+// Write the book as an EPUB 3 archive
+func (b *Book) Write(w io.Writer) error {
+	if b.Language == "" {
+		b.Language = "en"
+	}
+
+	if b.Identifier == "" {
+		sum := sha256.Sum256([]byte(b.Title))
+		b.Identifier = fmt.Sprintf("urn:uuid:%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+	}
+
+	if b.Modified.IsZero() {
+		b.Modified = time.Now()
+	}
+
+	archive := zip.NewWriter(w)
+
+	// The mimetype comes first and is not compressed
+	mimetype, err := archive.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		return err
+	}
+
+	_, err = mimetype.Write([]byte("application/epub+zip"))
+	if err != nil {
+		return err
+	}
+
+	files := []archiveFile{
+		{"META-INF/container.xml", []byte(container)},
+		{"OEBPS/content.opf", b.packageDocument()},
+		{"OEBPS/nav.xhtml", b.navigationDocument()},
+	}
+
+	for _, chapter := range b.Chapters {
+		files = append(files, archiveFile{"OEBPS/" + chapter.File, chapter.Content})
+	}
+
+	for _, resource := range b.Resources {
+		files = append(files, archiveFile{"OEBPS/" + resource.File, resource.Content})
+	}
+
+	for _, file := range files {
+		writer, err := archive.Create(file.name)
+		if err != nil {
+			return err
+		}
+
+		_, err = writer.Write(file.content)
+		if err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+// Returns the media type of a file in the book
+func MediaType(file string) string {
+	extension := strings.ToLower(path.Ext(file))
+	switch extension {
+	case ".html", ".xhtml", ".htm":
+		return "application/xhtml+xml"
+	case ".css":
+		return "text/css"
+	case ".svg":
+		return "image/svg+xml"
+	case ".js":
+		return "application/javascript"
+	}
+
+	mediaType := mime.TypeByExtension(extension)
+	if mediaType == "" {
+		return "application/octet-stream"
+	}
+
+	// Leave off parameters such as the charset
+	return strings.TrimSpace(strings.Split(mediaType, ";")[0])
+}
+
+// Returns the stylesheets of the book relative to the package document
+func (b *Book) Stylesheets() []string {
+	stylesheets := make([]string, 0)
+	for _, resource := range b.Resources {
+		if MediaType(resource.File) == "text/css" {
+			stylesheets = append(stylesheets, resource.File)
+		}
+	}
+
+	return stylesheets
+}
+
+type manifestItem struct {
+	Id         string
+	File       string
+	MediaType  string
+	Properties string
+}
+
+func (b *Book) packageDocument() []byte {
+	items := make([]manifestItem, 0, len(b.Chapters)+len(b.Resources))
+	spine := make([]string, 0, len(b.Chapters))
+	for i, chapter := range b.Chapters {
+		id := fmt.Sprintf("chapter-%d", i)
+		item := manifestItem{Id: id, File: chapter.File, MediaType: MediaType(chapter.File)}
+		// Reading systems are told about chapters with inline diagrams
+		if bytes.Contains(chapter.Content, []byte("<svg")) {
+			item.Properties = "svg"
+		}
+		items = append(items, item)
+		spine = append(spine, id)
+	}
+
+	for i, resource := range b.Resources {
+		items = append(items, manifestItem{Id: fmt.Sprintf("resource-%d", i), File: resource.File, MediaType: MediaType(resource.File)})
+	}
+
+	buffer := bytes.NewBuffer(nil)
+	packageTemplate.Execute(buffer, map[string]interface{}{
+		"Book":     b,
+		"Modified": b.Modified.UTC().Format("2006-01-02T15:04:05Z"),
+		"Items":    items,
+		"Spine":    spine,
+	})
+	return buffer.Bytes()
+}
+
+func (b *Book) navigationDocument() []byte {
+	body := bytes.NewBuffer(nil)
+	body.WriteString("<nav epub:type=\"toc\" id=\"toc\">\n")
+	body.WriteString(fmt.Sprintf("<h1>%s</h1>\n<ol>\n", escape(b.Title)))
+	for _, chapter := range b.Chapters {
+		body.WriteString(fmt.Sprintf("<li><a href=\"%s\">%s</a></li>\n", escape(chapter.File), escape(chapter.Title)))
+	}
+	body.WriteString("</ol>\n</nav>")
+
+	return Document(b.Title, body.Bytes(), b.Stylesheets(), b.Language)
+}
+
+func escape(text string) string {
+	return template.HTMLEscapeString(text)
+}
+
+const container = `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+	<rootfiles>
+		<rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+	</rootfiles>
+</container>
+`
+
+var packageTemplate = template.Must(template.New("package").Funcs(template.FuncMap{"escape": escape}).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="book-id" xml:lang="{{escape .Book.Language}}">
+	<metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+		<dc:identifier id="book-id">{{escape .Book.Identifier}}</dc:identifier>
+		<dc:title>{{escape .Book.Title}}</dc:title>
+		<dc:language>{{escape .Book.Language}}</dc:language>
+		{{if .Book.Author}}<dc:creator>{{escape .Book.Author}}</dc:creator>{{end}}
+		{{if .Book.Description}}<dc:description>{{escape .Book.Description}}</dc:description>{{end}}
+		<meta property="dcterms:modified">{{.Modified}}</meta>
+	</metadata>
+	<manifest>
+		<item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+		{{range .Items}}<item id="{{.Id}}" href="{{escape .File}}" media-type="{{.MediaType}}"{{if .Properties}} properties="{{.Properties}}"{{end}}/>
+		{{end}}
+	</manifest>
+	<spine>
+		{{range .Spine}}<itemref idref="{{.}}"/>
+		{{end}}
+	</spine>
+</package>
+`))
@@ -0,0 +1,82 @@
+package epub
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+/**
+ * Tests
+ **/
+func TestXHTML(t *testing.T) {
+	html := XHTML([]byte("&ldquo;Node&rdquo; &amp; &lt;Mongo&gt; &mdash; &bogus;"))
+	if string(html) != "&#8220;Node&#8221; &amp; &lt;Mongo&gt; &#8212; &amp;bogus;" {
+		t.Errorf("unexpected xhtml [%s]", html)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	book := &Book{Title: "Learn Node & MongoDB",
+		Chapters: []Chapter{
+			{File: "ex0.html", Title: "The Setup", Content: Document("The Setup", []byte("<h1>The Setup</h1>"), []string{"page.css"}, "en")},
+			{File: "ex1.html", Title: "The Package Manager", Content: Document("The Package Manager", []byte("<h1>npm</h1>"), []string{"page.css"}, "en")},
+		},
+		Resources: []Resource{{File: "page.css", Content: []byte("body {}")}},
+	}
+
+	buffer := bytes.NewBuffer(nil)
+	err := book.Write(buffer)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+
+	// The mimetype has to be the first file and stored as is
+	if archive.File[0].Name != "mimetype" || archive.File[0].Method != zip.Store {
+		t.Errorf("expected an uncompressed mimetype first got %s", archive.File[0].Name)
+	}
+
+	files := make(map[string]string)
+	for _, file := range archive.File {
+		reader, err := file.Open()
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+
+		content, _ := ioutil.ReadAll(reader)
+		reader.Close()
+		files[file.Name] = string(content)
+	}
+
+	for _, name := range []string{"META-INF/container.xml", "OEBPS/content.opf", "OEBPS/nav.xhtml", "OEBPS/ex0.html", "OEBPS/ex1.html", "OEBPS/page.css"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("expected %s in the book", name)
+		}
+	}
+
+	opf := files["OEBPS/content.opf"]
+	expected := []string{
+		`<dc:title>Learn Node &amp; MongoDB</dc:title>`,
+		`<item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>`,
+		`<item id="chapter-1" href="ex1.html" media-type="application/xhtml+xml"/>`,
+		`<item id="resource-0" href="page.css" media-type="text/css"/>`,
+		`<itemref idref="chapter-0"/>`,
+	}
+
+	for _, e := range expected {
+		if !strings.Contains(opf, e) {
+			t.Errorf("expected %s in [%s]", e, opf)
+		}
+	}
+
+	if !strings.Contains(files["OEBPS/nav.xhtml"], `<li><a href="ex1.html">The Package Manager</a></li>`) {
+		t.Errorf("expected the chapters in the navigation document [%s]", files["OEBPS/nav.xhtml"])
+	}
+}
@@ -0,0 +1,43 @@
+package format
+
+import (
+	"bytes"
+	"gutenberg.org/epub"
+	"time"
+)
+
+func init() {
+	Register(&Format{Name: "epub", Extension: ".epub", Renderer: htmlRenderer, Package: packageEpub})
+}
+
+// Package the pages as the chapters of an epub along with the files, the page
+// layout of the format renders the body of every chapter
+func packageEpub(book *Book) error {
+	c := book.Config
+	e := &epub.Book{Identifier: c.Book.Identifier,
+		Title:       c.Book.Title,
+		Author:      c.Book.Author,
+		Description: c.Book.Description,
+		Language:    c.Book.Language,
+		Modified:    time.Now(),
+	}
+
+	for _, file := range book.Files {
+		e.Resources = append(e.Resources, epub.Resource{File: file.Name, Content: file.Content})
+	}
+
+	for _, page := range book.Pages {
+		e.Chapters = append(e.Chapters, epub.Chapter{File: page.File,
+			Title:   page.Title,
+			Content: epub.Document(page.Title, page.Content, e.Stylesheets(), e.Language),
+		})
+	}
+
+	buffer := bytes.NewBuffer(nil)
+	err := e.Write(buffer)
+	if err != nil {
+		return err
+	}
+
+	return book.Write("book.epub", buffer.Bytes())
+}
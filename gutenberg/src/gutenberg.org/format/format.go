@@ -0,0 +1,127 @@
+package format
+
+import (
+	"fmt"
+	gutenberg "gutenberg.org"
+	"gutenberg.org/config"
+	"log"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// An output format of the book. Formats without a packaging step write every
+// page to its own file next to the assets and can be regenerated page by
+// page, the others get all the rendered pages at once to package them up.
+type Format struct {
+	Name string
+	// Extension of the files the format writes, e.g. ".html"
+	Extension string
+	// Create the renderer for a page, pages are the html files of all the
+	// pages of the book the links in the markdown point to, references resolve
+	// to the labels
+	Renderer func(c *config.Config, logger *log.Logger, page string, title string, pages []string, labels *gutenberg.Labels) gutenberg.MarkdownTransformer
+	// Package the rendered pages into the output directory
+	Package func(book *Book) error
+	// The page layout renders the whole book in the packaging step instead
+	// of every page
+	BookLayout bool
+}
+
+// A rendered page of the book
+type Page struct {
+	// The markdown file
+	Source string
+	// The html file links to the page point to, e.g. ex0.html
+	File   string
+	Title  string
+	Number int
+	// The rendered page, passed through the page layout unless the format
+	// has a book layout
+	Content []byte
+}
+
+// A file that goes with the pages such as a stylesheet
+type File struct {
+	Name    string
+	Content []byte
+}
+
+// Everything the packaging step of a format gets
+type Book struct {
+	Config *config.Config
+	Pages  []Page
+	// The assets and the stylesheet for the highlighted code
+	Files []File
+	// The page layout of the format if it has a book layout
+	Layout *template.Template
+	// Returns the template context of the book with the content as .Page
+	Context func(content string) map[string]interface{}
+	// Write a file to the output directory
+	Write func(name string, content []byte) error
+}
+
+var formats = make(map[string]*Format)
+
+// Make a format available by its name
+func Register(f *Format) {
+	formats[f.Name] = f
+}
+
+// Returns the format with the name or nil
+func Lookup(name string) *Format {
+	return formats[name]
+}
+
+// Returns the names of all the formats
+func Names() []string {
+	names := make([]string, 0, len(formats))
+	for name := range formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Returns the formats of a comma separated list of names such as "html,epub"
+func Select(list string) ([]*Format, error) {
+	selected := make([]*Format, 0)
+	seen := make(map[string]bool)
+
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+
+		f := Lookup(name)
+		if f == nil {
+			return nil, fmt.Errorf("unknown output format %s, the formats are %s", name, strings.Join(Names(), ", "))
+		}
+
+		seen[name] = true
+		selected = append(selected, f)
+	}
+
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("no output format selected")
+	}
+
+	return selected, nil
+}
+
+// Returns the layouts of the format from the configuration
+func (f *Format) Layout(c *config.Config) config.Layout {
+	return c.Layouts[f.Name]
+}
+
+// Returns the name of the file a page is written to, the pages of packaged
+// formats keep the html names the links point to
+func (f *Format) PageFile(page config.TableOfContentsEntry) string {
+	if f.Package != nil {
+		return page.OutputName()
+	}
+
+	return strings.TrimSuffix(page.OutputName(), ".html") + f.Extension
+}
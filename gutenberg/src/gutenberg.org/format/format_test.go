@@ -0,0 +1,74 @@
+package format
+
+import (
+	"gutenberg.org/config"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+/**
+ * Tests
+ **/
+func TestSelect(t *testing.T) {
+	selected, err := Select("html, epub,html")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+
+	if len(selected) != 2 || selected[0].Name != "html" || selected[1].Name != "epub" {
+		t.Errorf("expected html and epub got %v", selected)
+	}
+
+	_, err = Select("html,pdf")
+	if err == nil || !strings.Contains(err.Error(), "unknown output format pdf") {
+		t.Errorf("expected an error for an unknown format got %v", err)
+	}
+}
+
+func TestPageFile(t *testing.T) {
+	page := config.TableOfContentsEntry{File: "ex0.md"}
+	if file := Lookup("html").PageFile(page); file != "ex0.html" {
+		t.Errorf("expected ex0.html got %s", file)
+	}
+
+	// Packaged formats keep the names the links point to
+	if file := Lookup("latex").PageFile(page); file != "ex0.html" {
+		t.Errorf("expected ex0.html got %s", file)
+	}
+}
+
+func TestSinglePage(t *testing.T) {
+	written := make(map[string]string)
+	book := &Book{Config: &config.Config{},
+		Pages: []Page{
+			{Source: "ex0.md", File: "ex0.html", Title: "The Setup", Number: 0, Content: []byte("<h1>Setup</h1>\n")},
+			{Source: "ex1.md", File: "ex1.html", Title: "npm", Number: 1, Content: []byte("<h1>npm</h1>\n")},
+		},
+		Files:  []File{{Name: "page.css", Content: []byte("body {}")}},
+		Layout: template.Must(template.New("single").Parse("{{range .Sections}}[{{.Id}} {{.Title}}]{{end}}\n{{.Page}}")),
+		Context: func(content string) map[string]interface{} {
+			return map[string]interface{}{"Page": content}
+		},
+		Write: func(name string, content []byte) error {
+			written[name] = string(content)
+			return nil
+		},
+	}
+
+	err := Lookup("single").Package(book)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+
+	expected := "[ex0 The Setup][ex1 npm]\n" +
+		"<section class=\"chapter\" id=\"ex0\">\n<h1>Setup</h1>\n</section>\n" +
+		"<section class=\"chapter\" id=\"ex1\">\n<h1>npm</h1>\n</section>\n"
+	if written["book.html"] != expected {
+		t.Errorf("expected [%s] got [%s]", expected, written["book.html"])
+	}
+
+	if _, ok := written["page.css"]; !ok {
+		t.Errorf("expected the files to be written")
+	}
+}
@@ -0,0 +1,65 @@
+package format
+
+import (
+	"bytes"
+	"fmt"
+	gutenberg "gutenberg.org"
+	"gutenberg.org/config"
+	"log"
+)
+
+func init() {
+	Register(&Format{Name: "html", Extension: ".html", Renderer: htmlRenderer})
+	Register(&Format{Name: "single", Extension: ".html", Renderer: singlePageRenderer, Package: packageSinglePage, BookLayout: true})
+}
+
+func htmlRenderer(c *config.Config, logger *log.Logger, page string, title string, pages []string, labels *gutenberg.Labels) gutenberg.MarkdownTransformer {
+	return gutenberg.NewPageHtml(c, logger, page, labels)
+}
+
+func singlePageRenderer(c *config.Config, logger *log.Logger, page string, title string, pages []string, labels *gutenberg.Labels) gutenberg.MarkdownTransformer {
+	return gutenberg.NewSinglePageHtml(c, logger, page, pages, labels)
+}
+
+// A page of the table of contents in the single page book
+type Section struct {
+	Page
+	// Id of the element the page is wrapped in
+	Id string
+}
+
+// Put every page in the order of the table of contents into one page with the
+// page layout of the single format. The layout gets the sections as .Sections
+// and all of them wrapped in their elements as .Page.
+func packageSinglePage(book *Book) error {
+	if book.Layout == nil {
+		return fmt.Errorf("the single format needs a page layout")
+	}
+
+	sections := make([]Section, 0, len(book.Pages))
+	combined := bytes.NewBuffer(nil)
+	for _, page := range book.Pages {
+		section := Section{Page: page, Id: gutenberg.SectionId(page.File)}
+		sections = append(sections, section)
+		combined.WriteString(fmt.Sprintf("<section class=\"chapter\" id=\"%s\">\n%s</section>\n", section.Id, page.Content))
+	}
+
+	context := book.Context(combined.String())
+	context["Sections"] = sections
+
+	buffer := bytes.NewBuffer(nil)
+	err := book.Layout.Execute(buffer, context)
+	if err != nil {
+		return err
+	}
+
+	// The page links the assets and the styles for the code
+	for _, file := range book.Files {
+		err = book.Write(file.Name, file.Content)
+		if err != nil {
+			return err
+		}
+	}
+
+	return book.Write("book.html", buffer.Bytes())
+}
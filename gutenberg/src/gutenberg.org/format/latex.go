@@ -0,0 +1,39 @@
+package format
+
+import (
+	"fmt"
+	gutenberg "gutenberg.org"
+	"gutenberg.org/config"
+	"io/ioutil"
+	"log"
+)
+
+func init() {
+	Register(&Format{Name: "latex", Extension: ".tex", Renderer: latexRenderer, Package: packageLatex})
+}
+
+func latexRenderer(c *config.Config, logger *log.Logger, page string, title string, pages []string, labels *gutenberg.Labels) gutenberg.MarkdownTransformer {
+	return gutenberg.NewLatex(c, logger, page, title, pages, labels)
+}
+
+// Put the pages together as the chapters of one LaTeX book with the
+// configured preamble
+func packageLatex(book *Book) error {
+	c := book.Config
+
+	var preamble []byte
+	if c.LatexPreamble != "" {
+		var err error
+		preamble, err = ioutil.ReadFile(fmt.Sprintf("%s/%s", c.SourcePath, c.LatexPreamble))
+		if err != nil {
+			return err
+		}
+	}
+
+	chapters := make([][]byte, 0, len(book.Pages))
+	for _, page := range book.Pages {
+		chapters = append(chapters, page.Content)
+	}
+
+	return book.Write("book.tex", gutenberg.LatexBook(c.Book, preamble, chapters))
+}
@@ -0,0 +1,105 @@
+package gutenberg
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// Metadata at the top of a page, either YAML between "---" lines or
+// TOML between "+++" lines
+type FrontMatter struct {
+	Title       string   `yaml:"title" toml:"title"`
+	Description string   `yaml:"description" toml:"description"`
+	Draft       bool     `yaml:"draft" toml:"draft"`
+	Tags        []string `yaml:"tags" toml:"tags"`
+	// Layout to render the page with instead of the page layout
+	Layout string `yaml:"layout" toml:"layout"`
+	// Anything else the layouts need
+	Params map[string]interface{} `yaml:"params" toml:"params"`
+}
+
+// Splits the front matter off a page and returns it with the rest of the
+// page. Pages without front matter get an empty one and are left untouched.
+func ParseFrontMatter(data []byte) (*FrontMatter, []byte, error) {
+	frontMatter := &FrontMatter{Params: make(map[string]interface{})}
+
+	// Skip a byte order mark
+	content := bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	var delimiter []byte
+	switch {
+	case hasDelimiterLine(content, []byte("---")):
+		delimiter = []byte("---")
+	case hasDelimiterLine(content, []byte("+++")):
+		delimiter = []byte("+++")
+	default:
+		return frontMatter, data, nil
+	}
+
+	// Find the closing delimiter
+	start := bytes.IndexByte(content, '\n') + 1
+	end := -1
+	position := start
+	for position < len(content) {
+		lineEnd := bytes.IndexByte(content[position:], '\n')
+		line := content[position:]
+		if lineEnd != -1 {
+			line = content[position : position+lineEnd]
+		}
+
+		if bytes.Equal(bytes.TrimSpace(line), delimiter) {
+			end = position
+			break
+		}
+
+		if lineEnd == -1 {
+			break
+		}
+		position += lineEnd + 1
+	}
+
+	if end == -1 {
+		return nil, data, fmt.Errorf("front matter starting with %s is never closed", delimiter)
+	}
+
+	// The body starts after the closing delimiter line
+	body := content[end+len(delimiter):]
+	if index := bytes.IndexByte(body, '\n'); index != -1 {
+		body = body[index+1:]
+	} else {
+		body = nil
+	}
+
+	var err error
+	if delimiter[0] == '-' {
+		err = yaml.Unmarshal(content[start:end], frontMatter)
+	} else {
+		err = toml.Unmarshal(content[start:end], frontMatter)
+	}
+
+	if err != nil {
+		return nil, data, fmt.Errorf("invalid front matter: %v", err)
+	}
+
+	if frontMatter.Params == nil {
+		frontMatter.Params = make(map[string]interface{})
+	}
+
+	return frontMatter, body, nil
+}
+
+// Returns true if the first line of the content is just the delimiter
+func hasDelimiterLine(content []byte, delimiter []byte) bool {
+	if !bytes.HasPrefix(content, delimiter) {
+		return false
+	}
+
+	line := content
+	if index := bytes.IndexByte(content, '\n'); index != -1 {
+		line = content[:index]
+	}
+
+	return bytes.Equal(bytes.TrimSpace(line), delimiter)
+}
@@ -0,0 +1,62 @@
+package gutenberg
+
+import (
+	"testing"
+)
+
+/**
+ * Tests
+ **/
+func TestYamlFrontMatter(t *testing.T) {
+	page := "---\ntitle: Aggregation\ndraft: true\ntags: [mongodb, aggregation]\nlayout: layouts/wide.gtl\nparams:\n  level: advanced\n---\nAggregation\n===========\n"
+	frontMatter, body, err := ParseFrontMatter([]byte(page))
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+
+	if frontMatter.Title != "Aggregation" || !frontMatter.Draft || len(frontMatter.Tags) != 2 || frontMatter.Layout != "layouts/wide.gtl" {
+		t.Errorf("unexpected front matter %v", frontMatter)
+	}
+
+	if frontMatter.Params["level"] != "advanced" {
+		t.Errorf("unexpected params %v", frontMatter.Params)
+	}
+
+	if string(body) != "Aggregation\n===========\n" {
+		t.Errorf("unexpected body [%s]", body)
+	}
+}
+
+func TestTomlFrontMatter(t *testing.T) {
+	page := "+++\ntitle = \"Aggregation\"\ndescription = \"The pipeline\"\n[params]\nlevel = \"advanced\"\n+++\nBody"
+	frontMatter, body, err := ParseFrontMatter([]byte(page))
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+
+	if frontMatter.Title != "Aggregation" || frontMatter.Description != "The pipeline" || frontMatter.Params["level"] != "advanced" {
+		t.Errorf("unexpected front matter %v", frontMatter)
+	}
+
+	if string(body) != "Body" {
+		t.Errorf("unexpected body [%s]", body)
+	}
+}
+
+func TestWithoutFrontMatter(t *testing.T) {
+	for _, page := range []string{"Exercise 0: The Setup\n=====\n", "--- not front matter\n", ""} {
+		frontMatter, body, err := ParseFrontMatter([]byte(page))
+		if err != nil {
+			t.Fatalf("%q", err)
+		}
+
+		if string(body) != page || frontMatter.Title != "" {
+			t.Errorf("expected the page to be untouched got [%s]", body)
+		}
+	}
+
+	_, _, err := ParseFrontMatter([]byte("---\ntitle: open\n"))
+	if err == nil {
+		t.Errorf("expected an error for unclosed front matter")
+	}
+}
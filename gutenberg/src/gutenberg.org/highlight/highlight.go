@@ -0,0 +1,115 @@
+package highlight
+
+import (
+	"bytes"
+	"strings"
+)
+
+// The kinds of tokens a lexer can produce
+type TokenType int
+
+const (
+	Text TokenType = iota
+	Keyword
+	KeywordConstant
+	Builtin
+	Tag
+	Attribute
+	Variable
+	String
+	Number
+	Comment
+	Operator
+	Punctuation
+	Template
+	Entity
+
+	// Hands the match over to the rule's embedded lexer
+	Embedded
+)
+
+// The css classes for each token type, these are the same short names
+// pygments uses so existing pygments stylesheets keep working
+var classes = map[TokenType]string{
+	Keyword:         "k",
+	KeywordConstant: "kc",
+	Builtin:         "nb",
+	Tag:             "nt",
+	Attribute:       "na",
+	Variable:        "nv",
+	String:          "s",
+	Number:          "m",
+	Comment:         "c",
+	Operator:        "o",
+	Punctuation:     "p",
+	Template:        "cp",
+	Entity:          "ni",
+}
+
+type Token struct {
+	Type  TokenType
+	Value string
+}
+
+type Lexer interface {
+	Tokenize(source string) []Token
+}
+
+// All the lexers by language name
+var lexers = map[string]Lexer{}
+
+// Make a lexer available under one or more language names
+func Register(lexer Lexer, names ...string) {
+	for _, name := range names {
+		lexers[strings.ToLower(name)] = lexer
+	}
+}
+
+// Returns the lexer for a language or nil if there is none
+func LexerFor(lang string) Lexer {
+	return lexers[strings.ToLower(strings.TrimSpace(lang))]
+}
+
+// Highlight the source as html spans with one css class per token type.
+// Languages without a lexer are returned as escaped text and false.
+func Highlight(lang string, source []byte) ([]byte, bool) {
+	out := bytes.NewBuffer(nil)
+	lexer := LexerFor(lang)
+	if lexer == nil {
+		escape(out, string(source))
+		return out.Bytes(), false
+	}
+
+	for _, token := range lexer.Tokenize(string(source)) {
+		class := classes[token.Type]
+		if class == "" {
+			escape(out, token.Value)
+			continue
+		}
+
+		out.WriteString("<span class=\"")
+		out.WriteString(class)
+		out.WriteString("\">")
+		escape(out, token.Value)
+		out.WriteString("</span>")
+	}
+
+	return out.Bytes(), true
+}
+
+func escape(out *bytes.Buffer, text string) {
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '&':
+			out.WriteString("&amp;")
+		case '<':
+			out.WriteString("&lt;")
+		case '>':
+			out.WriteString("&gt;")
+		case '"':
+			out.WriteString("&quot;")
+		default:
+			out.WriteByte(text[i])
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package highlight
+
+import (
+	"strings"
+	"testing"
+)
+
+func tokensOf(t *testing.T, lang string, source string) []Token {
+	lexer := LexerFor(lang)
+	if lexer == nil {
+		t.Fatalf("no lexer for %s", lang)
+	}
+
+	// The tokens must always add up to the source
+	tokens := lexer.Tokenize(source)
+	values := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		values = append(values, token.Value)
+	}
+
+	if strings.Join(values, "") != source {
+		t.Errorf("tokens for %s do not add up to the source: %v", lang, tokens)
+	}
+
+	return tokens
+}
+
+func hasToken(tokens []Token, tokenType TokenType, value string) bool {
+	for _, token := range tokens {
+		if token.Type == tokenType && token.Value == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+/**
+ * Tests
+ **/
+func TestJavascript(t *testing.T) {
+	tokens := tokensOf(t, "js", "var a = require('mongodb'); // connect\nif(a > 1.5) return null;")
+	for _, expected := range []Token{{Keyword, "var"}, {Builtin, "require"}, {String, "'mongodb'"},
+		{Comment, "// connect"}, {Operator, ">"}, {Number, "1.5"}, {KeywordConstant, "null"}} {
+		if !hasToken(tokens, expected.Type, expected.Value) {
+			t.Errorf("expected %v in %v", expected, tokens)
+		}
+	}
+
+	// Keywords only match whole words
+	tokens = tokensOf(t, "javascript", "format")
+	if hasToken(tokens, Keyword, "for") {
+		t.Errorf("unexpected keyword in %v", tokens)
+	}
+}
+
+func TestJsonAndCss(t *testing.T) {
+	tokens := tokensOf(t, "json", `{"title": "Moby Dick", "published": 1992, "new": true}`)
+	if !hasToken(tokens, Attribute, `"title"`) || !hasToken(tokens, String, `"Moby Dick"`) || !hasToken(tokens, Number, "1992") {
+		t.Errorf("unexpected json tokens %v", tokens)
+	}
+
+	tokens = tokensOf(t, "css", ".board_row span {\n  margin-right: 5px;\n  color: #fff\n}")
+	if !hasToken(tokens, Attribute, ".board_row") || !hasToken(tokens, Keyword, "margin-right") || !hasToken(tokens, Number, "5px") {
+		t.Errorf("unexpected css tokens %v", tokens)
+	}
+}
+
+func TestMarkup(t *testing.T) {
+	tokens := tokensOf(t, "mustache", "<div class=\"span6\">{{#games}}<b>{{name}}</b>{{/games}}<script>var a = 1;</script></div>")
+	if !hasToken(tokens, Tag, "div") || !hasToken(tokens, Attribute, "class") || !hasToken(tokens, Template, "{{name}}") {
+		t.Errorf("unexpected mustache tokens %v", tokens)
+	}
+
+	if !hasToken(tokens, Keyword, "var") {
+		t.Errorf("expected embedded javascript in %v", tokens)
+	}
+
+	tokens = tokensOf(t, "html", "<p>a &amp; b {{name}}</p>")
+	if !hasToken(tokens, Entity, "&amp;") || hasToken(tokens, Template, "{{name}}") {
+		t.Errorf("unexpected html tokens %v", tokens)
+	}
+}
+
+func TestDotAndShell(t *testing.T) {
+	tokens := tokensOf(t, "dot", "digraph g {\n  node0[label = \"Doc 1\"];\n  \"node0\":f0 -> \"node1\":f0;\n}")
+	if !hasToken(tokens, Keyword, "digraph") || !hasToken(tokens, Attribute, "label") || !hasToken(tokens, Operator, "->") {
+		t.Errorf("unexpected dot tokens %v", tokens)
+	}
+
+	tokens = tokensOf(t, "shell", "export PATH=$HOME/bin # path\nnpm install mongodb")
+	if !hasToken(tokens, Keyword, "export") || !hasToken(tokens, Variable, "$HOME") || !hasToken(tokens, Comment, "# path") || !hasToken(tokens, Builtin, "npm") {
+		t.Errorf("unexpected shell tokens %v", tokens)
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	html, ok := Highlight("js", []byte("var a = \"<b>\";"))
+	if !ok || string(html) != `<span class="k">var</span> a <span class="o">=</span> <span class="s">&quot;&lt;b&gt;&quot;</span><span class="p">;</span>` {
+		t.Errorf("unexpected html [%s]", html)
+	}
+
+	// Unknown languages are escaped but always render
+	html, ok = Highlight("console", []byte("$ echo <a>"))
+	if ok || string(html) != "$ echo &lt;a&gt;" {
+		t.Errorf("unexpected html [%s]", html)
+	}
+}
+
+func TestStylesheet(t *testing.T) {
+	css, err := Stylesheet("", ".highlight")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+
+	if !strings.Contains(string(css), ".highlight .k { color: #204a87; font-weight: bold }") {
+		t.Errorf("unexpected stylesheet [%s]", css)
+	}
+
+	_, err = Stylesheet("missing", ".highlight")
+	if err == nil {
+		t.Errorf("expected an error for an unknown theme")
+	}
+}
@@ -0,0 +1,121 @@
+package highlight
+
+import (
+	"regexp"
+	"unicode/utf8"
+)
+
+// A single lexer rule, the pattern is matched at the current position and
+// either the whole match or each of its groups becomes a token
+type rule struct {
+	pattern  *regexp.Regexp
+	types    []TokenType
+	next     string
+	embedded Lexer
+}
+
+// Match the pattern as one token
+func token(pattern string, types ...TokenType) rule {
+	return rule{pattern: regexp.MustCompile(`^(?:` + pattern + `)`), types: types}
+}
+
+// Match the pattern and move to a new state
+func push(state string, pattern string, types ...TokenType) rule {
+	r := token(pattern, types...)
+	r.next = state
+	return r
+}
+
+// Match the pattern and return to the previous state
+func pop(pattern string, types ...TokenType) rule {
+	return push("#pop", pattern, types...)
+}
+
+// Match the pattern and hand the Embedded groups to another lexer
+func embed(lexer Lexer, next string, pattern string, types ...TokenType) rule {
+	r := push(next, pattern, types...)
+	r.embedded = lexer
+	return r
+}
+
+// A lexer driven by a stack of states, each with a list of rules that
+// are tried in order. The lexer starts in the "root" state.
+type RegexLexer struct {
+	states map[string][]rule
+}
+
+func (l *RegexLexer) Tokenize(source string) []Token {
+	tokens := make([]Token, 0)
+	stack := []string{"root"}
+
+	emit := func(tokenType TokenType, value string) {
+		if len(value) == 0 {
+			return
+		}
+
+		// Merge neighbouring tokens of the same type
+		if len(tokens) > 0 && tokens[len(tokens)-1].Type == tokenType {
+			tokens[len(tokens)-1].Value += value
+			return
+		}
+
+		tokens = append(tokens, Token{Type: tokenType, Value: value})
+	}
+
+	position := 0
+	for position < len(source) {
+		rest := source[position:]
+		matched := false
+
+		for _, r := range l.states[stack[len(stack)-1]] {
+			match := r.pattern.FindStringSubmatchIndex(rest)
+			if match == nil || match[1] == 0 {
+				continue
+			}
+
+			if len(r.types) == 1 {
+				emit(r.types[0], rest[:match[1]])
+			} else {
+				// One token per group, anything between groups is text
+				end := 0
+				for i, tokenType := range r.types {
+					start, stop := match[2*i+2], match[2*i+3]
+					if start < 0 {
+						continue
+					}
+
+					emit(Text, rest[end:start])
+					if tokenType == Embedded && r.embedded != nil {
+						for _, embedded := range r.embedded.Tokenize(rest[start:stop]) {
+							emit(embedded.Type, embedded.Value)
+						}
+					} else {
+						emit(tokenType, rest[start:stop])
+					}
+					end = stop
+				}
+				emit(Text, rest[end:match[1]])
+			}
+
+			switch {
+			case r.next == "#pop" && len(stack) > 1:
+				stack = stack[:len(stack)-1]
+			case r.next != "" && r.next != "#pop":
+				stack = append(stack, r.next)
+			}
+
+			position += match[1]
+			matched = true
+			break
+		}
+
+		// Nothing matched, let the character through as text
+		if !matched {
+			_, size := utf8.DecodeRuneInString(rest)
+			emit(Text, rest[:size])
+			position += size
+		}
+	}
+
+	return tokens
+}
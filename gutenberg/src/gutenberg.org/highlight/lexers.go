@@ -0,0 +1,160 @@
+package highlight
+
+const (
+	doubleQuoted = `"(?:\\.|[^"\\\n])*"`
+	singleQuoted = `'(?:\\.|[^'\\\n])*'`
+	blockComment = `/\*[\s\S]*?\*/`
+)
+
+func init() {
+	javascript := &RegexLexer{states: map[string][]rule{
+		"root": []rule{
+			token(`\s+`, Text),
+			token(`//[^\n]*`, Comment),
+			token(blockComment, Comment),
+			token(doubleQuoted, String),
+			token(singleQuoted, String),
+			token("`(?:\\\\.|[^`\\\\])*`", String),
+			token(`0[xX][0-9a-fA-F]+|(?:\d+\.?\d*|\.\d+)(?:[eE][+-]?\d+)?`, Number),
+			token(`(?:var|let|const|function|return|if|else|for|while|do|switch|case|default|break|continue|new|delete|typeof|instanceof|in|of|this|throw|try|catch|finally|class|extends|super|import|export|from|void|with|yield)\b`, Keyword),
+			token(`(?:true|false|null|undefined|NaN|Infinity)\b`, KeywordConstant),
+			token(`(?:require|module|exports|console|process|JSON|Math|Object|Array|String|Number|Boolean|Date|RegExp|Error|setTimeout|setInterval|clearTimeout|clearInterval)\b`, Builtin),
+			token(`[A-Za-z_$][\w$]*`, Text),
+			token(`[-+*/%=<>!&|^~?:]+`, Operator),
+			token(`[{}()\[\];,.]`, Punctuation),
+		},
+	}}
+	Register(javascript, "javascript", "js", "node")
+
+	json := &RegexLexer{states: map[string][]rule{
+		"root": []rule{
+			token(`\s+`, Text),
+			token(`//[^\n]*`, Comment),
+			token(blockComment, Comment),
+			token(`(`+doubleQuoted+`)(\s*)(:)`, Attribute, Text, Punctuation),
+			token(doubleQuoted, String),
+			token(`-?(?:\d+\.?\d*|\.\d+)(?:[eE][+-]?\d+)?`, Number),
+			token(`(?:true|false|null)\b`, KeywordConstant),
+			token(`[A-Za-z_$][\w$]*`, Builtin),
+			token(`[{}\[\](),:]`, Punctuation),
+		},
+	}}
+	Register(json, "json")
+
+	css := &RegexLexer{states: map[string][]rule{
+		"root": []rule{
+			token(`\s+`, Text),
+			token(blockComment, Comment),
+			token(`@[\w-]+`, Keyword),
+			push("block", `\{`, Punctuation),
+			token(`[.#][\w-]+`, Attribute),
+			token(`::?[\w-]+`, Keyword),
+			token(`[\w-]+|\*`, Tag),
+			token(doubleQuoted, String),
+			token(singleQuoted, String),
+			token(`[,>+~\[\]=()]`, Punctuation),
+		},
+		"block": []rule{
+			token(`\s+`, Text),
+			token(blockComment, Comment),
+			token(`([\w-]+)(\s*)(:)`, Keyword, Text, Punctuation),
+			push("block", `\{`, Punctuation),
+			pop(`\}`, Punctuation),
+			token(`#[0-9a-fA-F]+\b`, Number),
+			token(`-?(?:\d+\.?\d*|\.\d+)(?:px|em|rem|ex|pt|pc|cm|mm|in|vh|vw|deg|ms|s|%)?`, Number),
+			token(doubleQuoted, String),
+			token(singleQuoted, String),
+			token(`!important\b`, Keyword),
+			token(`[\w-]+`, Builtin),
+			token(`[;,/()]`, Punctuation),
+		},
+	}}
+	Register(css, "css")
+
+	Register(markupLexer(javascript, css, false), "html", "htm", "xml", "xhtml")
+	Register(markupLexer(javascript, css, true), "mustache", "ms", "handlebars", "hbs")
+
+	dot := &RegexLexer{states: map[string][]rule{
+		"root": []rule{
+			token(`\s+`, Text),
+			token(`//[^\n]*`, Comment),
+			token(`#[^\n]*`, Comment),
+			token(blockComment, Comment),
+			token(`(?i:strict|digraph|graph|subgraph|node|edge)\b`, Keyword),
+			token(`->|--`, Operator),
+			token(`([A-Za-z_][\w.]*)(\s*)(=)`, Attribute, Text, Operator),
+			token(doubleQuoted, String),
+			token(`<[^<>]*(?:<[^<>]*>[^<>]*)*>`, String),
+			token(`-?(?:\.\d+|\d+(?:\.\d*)?)`, Number),
+			token(`[A-Za-z_\x80-\xff][\w\x80-\xff]*`, Text),
+			token(`[{}\[\];,:=]`, Punctuation),
+		},
+	}}
+	Register(dot, "dot", "graph", "graphviz", "gv")
+
+	shell := &RegexLexer{states: map[string][]rule{
+		"root": []rule{
+			token(`\s+`, Text),
+			token(`#[^\n]*`, Comment),
+			token(`\$\{[^}\n]*\}|\$\(|\$[\w@*#?$!-]+`, Variable),
+			token(doubleQuoted, String),
+			token(`'[^']*'`, String),
+			token(`(?:if|then|else|elif|fi|for|in|do|done|case|esac|while|until|function|return|export|local|select)\b`, Keyword),
+			token(`(?:echo|cd|ls|cat|pwd|mkdir|rm|cp|mv|source|sudo|curl|wget|tar|unzip|chmod|npm|node|mongo|mongod|mongos|git)\b`, Builtin),
+			token(`&&|\|\||[|&;<>]`, Operator),
+			token(`\d+\b`, Number),
+			token(`[^\s$"'#|&;<>(){}\[\]]+`, Text),
+			token(`[(){}\[\]]`, Punctuation),
+		},
+	}}
+	Register(shell, "shell", "sh", "bash", "zsh")
+}
+
+// Html with embedded javascript and css, optionally with mustache tags
+func markupLexer(javascript Lexer, css Lexer, mustache bool) Lexer {
+	var mustacheRules []rule
+	if mustache {
+		mustacheRules = []rule{
+			token(`\{\{![\s\S]*?\}\}`, Comment),
+			token(`\{\{\{[\s\S]*?\}\}\}`, Template),
+			token(`\{\{[\s\S]*?\}\}`, Template),
+		}
+	}
+
+	// Mustache tags can appear anywhere, including attribute values
+	tagRules := append(mustacheRules,
+		token(`\s+`, Text),
+		token(`([\w:.-]+)(\s*)(=)`, Attribute, Text, Operator),
+		token(doubleQuoted, String),
+		token(singleQuoted, String),
+		token(`[\w:.-]+`, Attribute),
+		pop(`/?>`, Punctuation),
+	)
+
+	// The content of script and style tags is handed to their own lexer
+	scriptRules := append([]rule{
+		embed(javascript, "#pop", `(>)([\s\S]*?)(</)(script)(\s*>)`, Punctuation, Embedded, Punctuation, Tag, Punctuation),
+	}, tagRules...)
+	styleRules := append([]rule{
+		embed(css, "#pop", `(>)([\s\S]*?)(</)(style)(\s*>)`, Punctuation, Embedded, Punctuation, Tag, Punctuation),
+	}, tagRules...)
+
+	root := append(mustacheRules,
+		token(`<!--[\s\S]*?-->`, Comment),
+		token(`<![^>]*>`, Template),
+		token(`<\?[\s\S]*?\?>`, Template),
+		push("script", `(<)((?i:script))\b`, Punctuation, Tag),
+		push("style", `(<)((?i:style))\b`, Punctuation, Tag),
+		push("tag", `(</?)([\w:.-]+)`, Punctuation, Tag),
+		token(`&#?\w+;`, Entity),
+		token(`[^<&{]+`, Text),
+		token(`[<&{]`, Text),
+	)
+
+	return &RegexLexer{states: map[string][]rule{
+		"root":   root,
+		"tag":    tagRules,
+		"script": scriptRules,
+		"style":  styleRules,
+	}}
+}
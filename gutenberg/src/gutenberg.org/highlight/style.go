@@ -0,0 +1,89 @@
+package highlight
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+)
+
+// A colour scheme for the highlighted code, each style is a list of
+// css declarations
+type Theme struct {
+	Background string
+	Foreground string
+	Styles     map[TokenType]string
+}
+
+var Themes = map[string]*Theme{
+	"tango": &Theme{
+		Background: "#f8f8f8",
+		Foreground: "#000000",
+		Styles: map[TokenType]string{
+			Keyword:         "color: #204a87; font-weight: bold",
+			KeywordConstant: "color: #204a87; font-weight: bold",
+			Builtin:         "color: #204a87",
+			Tag:             "color: #204a87; font-weight: bold",
+			Attribute:       "color: #c4a000",
+			Variable:        "color: #000000",
+			String:          "color: #4e9a06",
+			Number:          "color: #0000cf; font-weight: bold",
+			Comment:         "color: #8f5902; font-style: italic",
+			Operator:        "color: #ce5c00; font-weight: bold",
+			Punctuation:     "color: #000000; font-weight: bold",
+			Template:        "color: #8f5902; font-style: italic",
+			Entity:          "color: #ce5c00",
+		},
+	},
+	"monokai": &Theme{
+		Background: "#272822",
+		Foreground: "#f8f8f2",
+		Styles: map[TokenType]string{
+			Keyword:         "color: #66d9ef",
+			KeywordConstant: "color: #66d9ef",
+			Builtin:         "color: #f8f8f2",
+			Tag:             "color: #f92672",
+			Attribute:       "color: #a6e22e",
+			Variable:        "color: #f8f8f2",
+			String:          "color: #e6db74",
+			Number:          "color: #ae81ff",
+			Comment:         "color: #75715e",
+			Operator:        "color: #f92672",
+			Punctuation:     "color: #f8f8f2",
+			Template:        "color: #75715e",
+			Entity:          "color: #f8f8f2",
+		},
+	},
+}
+
+const DefaultTheme = "tango"
+
+// Generate the stylesheet for a theme, all the rules are scoped
+// to elements with the given class (e.g. ".highlight")
+func Stylesheet(theme string, scope string) ([]byte, error) {
+	if theme == "" {
+		theme = DefaultTheme
+	}
+
+	t := Themes[theme]
+	if t == nil {
+		return nil, fmt.Errorf("unknown highlight theme %s", theme)
+	}
+
+	// Sort the rules by class so the output is stable
+	rules := make([]string, 0, len(t.Styles))
+	for tokenType, style := range t.Styles {
+		class := classes[tokenType]
+		if class != "" {
+			rules = append(rules, fmt.Sprintf("%s .%s { %s }\n", scope, class, style))
+		}
+	}
+	sort.Strings(rules)
+
+	out := bytes.NewBuffer(nil)
+	fmt.Fprintf(out, "%s { background-color: %s; color: %s }\n", scope, t.Background, t.Foreground)
+	for _, rule := range rules {
+		out.WriteString(rule)
+	}
+
+	return out.Bytes(), nil
+}
@@ -0,0 +1,106 @@
+package gutenberg
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	tags          = regexp.MustCompile(`<[^>]*>`)
+	notIdentifier = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// Returns the id for a heading from its rendered html, e.g. "exercise-5-documents"
+// for "Exercise 5: <em>Documents</em>"
+func Slugify(content []byte) string {
+	text := html.UnescapeString(tags.ReplaceAllString(string(content), ""))
+	slug := strings.Trim(notIdentifier.ReplaceAllString(strings.ToLower(text), "-"), "-")
+	if slug == "" {
+		return "section"
+	}
+
+	return slug
+}
+
+// Returns the id of the section a page becomes in the single page book,
+// e.g. "ex0" for ex0.html
+func SectionId(page string) string {
+	return Slugify([]byte(strings.TrimSuffix(page, ".html")))
+}
+
+// Hands out the heading ids of a page and points its links into the single
+// page book
+type headingIds struct {
+	// Section of the page in the single page book, empty for a page on its own
+	section string
+	// Sections of the pages of the book by the file they are rendered to
+	sections map[string]string
+	// Heading ids handed out so far
+	ids map[string]int
+}
+
+func newHeadingIds(section string, sections map[string]string) headingIds {
+	return headingIds{section: section, sections: sections, ids: make(map[string]int)}
+}
+
+// Returns a unique id for a heading, in the single page book the ids are
+// prefixed with the section of the page
+func (p *headingIds) headingId(content []byte) string {
+	id := Slugify(content)
+	if p.section != "" {
+		id = p.section + "-" + id
+	}
+
+	// Number repeated headings
+	count := p.ids[id]
+	p.ids[id] = count + 1
+	if count > 0 {
+		id = fmt.Sprintf("%s-%d", id, count)
+	}
+
+	return id
+}
+
+// Points links between the pages of the book and to the headings of the page
+// into the single page book, other links are left alone
+func (p *headingIds) rewriteLink(link []byte) []byte {
+	if p.section == "" {
+		return link
+	}
+
+	target := string(link)
+	page, fragment := target, ""
+	if index := strings.Index(target, "#"); index != -1 {
+		page, fragment = target[:index], target[index+1:]
+	}
+
+	section := p.section
+	if page != "" {
+		var ok bool
+		section, ok = p.sections[strings.TrimPrefix(page, "./")]
+		if !ok {
+			return link
+		}
+	}
+
+	if fragment == "" {
+		return []byte("#" + section)
+	}
+
+	return []byte("#" + section + "-" + fragment)
+}
+
+// Returns the id of a labeled heading, figure or listing, in the single page
+// book the label is prefixed with the section of the page like the headings.
+// The id is reserved so a later heading with the same text gets a numbered id.
+func (p *headingIds) labelId(label string) string {
+	id := label
+	if p.section != "" {
+		id = p.section + "-" + label
+	}
+
+	p.ids[id]++
+	return id
+}
@@ -0,0 +1,62 @@
+package gutenberg
+
+import (
+	"strings"
+	"testing"
+)
+
+/**
+ * Tests
+ **/
+func TestSlugify(t *testing.T) {
+	tests := map[string]string{
+		"Exercise 5: <em>Documents</em> everywhere": "exercise-5-documents-everywhere",
+		"Node.js &amp; MongoDB":                     "node-js-mongodb",
+		"<code>$lookup</code>":                      "lookup",
+		"!!!":                                       "section",
+	}
+
+	for content, expected := range tests {
+		if id := Slugify([]byte(content)); id != expected {
+			t.Errorf("expected [%s] got [%s] for [%s]", expected, id, content)
+		}
+	}
+}
+
+func TestHeadingIds(t *testing.T) {
+	html := string(NewCustomHtml(nil, nil).Transform([]byte("Setup\n=====\n\n## Install\n\n## Install\n")))
+	for _, expected := range []string{`<h1 id="setup">Setup</h1>`, `<h2 id="install">Install</h2>`, `<h2 id="install-1">Install</h2>`} {
+		if !strings.Contains(html, expected) {
+			t.Errorf("expected %s in [%s]", expected, html)
+		}
+	}
+}
+
+func TestLabelIds(t *testing.T) {
+	html := string(NewCustomHtml(nil, nil).Transform([]byte("# Setup {#intro}\n\n## Intro\n")))
+	for _, expected := range []string{`<h1 id="intro">Setup</h1>`, `<h2 id="intro-1">Intro</h2>`} {
+		if !strings.Contains(html, expected) {
+			t.Errorf("expected %s in [%s]", expected, html)
+		}
+	}
+}
+
+func TestSinglePageIds(t *testing.T) {
+	markdown := "# Setup\n\nSee [install](#install), [the next chapter](ex1.html), [its queries](./ex1.html#queries) and [node](http://nodejs.org).\n\n## Install\n"
+	html := string(NewSinglePageHtml(nil, nil, "ex0.html", []string{"ex0.html", "ex1.html"}, nil).Transform([]byte(markdown)))
+
+	expected := []string{
+		`<h1 id="ex0-setup">Setup</h1>`,
+		`<h2 id="ex0-install">Install</h2>`,
+		`<a href="#ex0-install">`,
+		`<a href="#ex1">`,
+		`<a href="#ex1-queries">`,
+		`<a href="http://nodejs.org">`,
+	}
+
+	for _, e := range expected {
+		if !strings.Contains(html, e) {
+			t.Errorf("expected %s in [%s]", e, html)
+		}
+	}
+}
@@ -0,0 +1,391 @@
+package gutenberg
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"gutenberg.org/config"
+	"io/ioutil"
+	"log"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Matches region marker comments such as "// #region insert", "# #endregion"
+// or "<!-- #region form -->", the first group is "end" for the end markers and
+// the second is the region name
+var regionMarker = regexp.MustCompile(`^\s*(?://|#|/\*|<!--|\{\{!)\s*#(end)?region\b\s*(.*?)\s*(?:\*/|-->|\}\})?\s*$`)
+
+// Matches the start or end of a fenced code block, the group is the marker
+var codeFence = regexp.MustCompile("^ {0,3}(```+|~~~+)")
+
+// Matches the opening line of a fenced code block with parameters, the groups
+// are the fence with the language and the parameters
+var fenceParameters = regexp.MustCompile("^( {0,3}(?:```+|~~~+)[^{\\s]*)(\\{.*\\})\\s*$")
+
+// Returns the fence of the code block a line is in after the line, empty
+// outside of fenced code blocks
+func trackFence(fence string, line string) string {
+	marker := codeFence.FindStringSubmatch(line)
+	if marker == nil {
+		return fence
+	}
+
+	if fence == "" {
+		return marker[1]
+	}
+
+	if strings.HasPrefix(marker[1], fence) && strings.TrimSpace(line) == marker[1] {
+		return ""
+	}
+
+	return fence
+}
+
+// Blackfriday ends the language of a fenced code block at the first space so
+// the spaces are taken out of the parameters, that way captions and markers
+// can have spaces in them and the json can be written with spaces
+func quoteFenceParameters(markdown []byte) []byte {
+	if !bytes.Contains(markdown, []byte("{")) {
+		return markdown
+	}
+
+	lines := strings.Split(string(markdown), "\n")
+	fence := ""
+	for i, line := range lines {
+		opening := fence == ""
+		fence = trackFence(fence, line)
+		if !opening || fence == "" {
+			continue
+		}
+
+		if match := fenceParameters.FindStringSubmatch(line); match != nil {
+			lines[i] = match[1] + packParameters(match[2])
+		}
+	}
+
+	return []byte(strings.Join(lines, "\n"))
+}
+
+// Drop the spaces between the values of a json value and write the spaces in
+// its strings as \u0020
+func packParameters(value string) string {
+	out := bytes.NewBuffer(nil)
+	inString, escaped := false, false
+	for _, ch := range value {
+		switch {
+		case escaped:
+			escaped = false
+		case inString && ch == '\\':
+			escaped = true
+		case ch == '"':
+			inString = !inString
+		case inString && ch == ' ':
+			out.WriteString(`\u0020`)
+			continue
+		case ch == ' ' || ch == '\t':
+			continue
+		}
+
+		out.WriteRune(ch)
+	}
+
+	return out.String()
+}
+
+// Reads the source of code blocks for the renderers and remembers the files
+// the blocks included
+type codeIncluder struct {
+	config *config.Config
+	logger *log.Logger
+	// Files included by code blocks
+	dependencies []string
+}
+
+func (p *codeIncluder) Dependencies() []string {
+	return p.dependencies
+}
+
+type langParameters struct {
+	File       string `json:"file"`
+	Indent     *int   `json:"indent"`
+	Lines      string `json:"lines"`
+	Region     string `json:"region"`
+	StartAfter string `json:"start_after"`
+	EndBefore  string `json:"end_before"`
+	// Caption of the figure for diagrams and of the listing for code
+	Caption string `json:"caption"`
+	// Label references to the figure or listing point to
+	Label string `json:"label"`
+}
+
+// Splits the json parameters off the language of a code block
+func parseLang(lang string) (string, *langParameters, error) {
+	params := &langParameters{}
+	index := strings.Index(lang, "{")
+	if index == -1 {
+		return lang, params, nil
+	}
+
+	err := json.Unmarshal([]byte(lang[index:]), params)
+	return lang[:index], params, err
+}
+
+// Splits the parameters off the language and returns the source of the
+// code block, either the block itself or the file it includes
+func (p *codeIncluder) blockSource(lang string, text []byte) (string, *langParameters, []byte, error) {
+	// Unpack the parameters
+	name, params, err := parseLang(lang)
+	if name == lang {
+		return lang, params, text, nil
+	}
+
+	if err != nil {
+		p.logger.Printf("configuration %s is not a valid json object\n", lang[len(name):])
+		return name, params, text, err
+	}
+	lang = name
+
+	source := text
+	if params.File != "" {
+		// Get the right path to the filename
+		fileName := fmt.Sprintf("%s/%s", p.config.SourcePath, params.File)
+		p.logger.Printf("Read source from file %s\n", fileName)
+
+		// Remember the file even if it can not be read, the page has to be
+		// regenerated when it changes or is created
+		p.dependencies = append(p.dependencies, strings.TrimPrefix(path.Clean("/"+params.File), "/"))
+
+		// Read the file in
+		source, err = ioutil.ReadFile(fileName)
+		if err != nil {
+			return lang, params, text, err
+		}
+	}
+
+	// Only keep the part of the source we asked for
+	source, err = selectSource(source, params)
+	if err != nil {
+		return lang, params, text, fmt.Errorf("%s: %v", params.File, err)
+	}
+
+	return lang, params, source, nil
+}
+
+// Selects the part of an included file the parameters ask for and indents it.
+// The lines range is applied first, the region, start_after and end_before
+// then narrow the selection down further. Region markers are always removed.
+func selectSource(source []byte, params *langParameters) ([]byte, error) {
+	text := string(source)
+	trailingNewline := strings.HasSuffix(text, "\n")
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+
+	var err error
+	if params.Lines != "" {
+		lines, err = selectLines(lines, params.Lines)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if params.Region != "" {
+		lines, err = selectRegion(lines, params.Region)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if params.StartAfter != "" || params.EndBefore != "" {
+		lines, err = selectBetween(lines, params.StartAfter, params.EndBefore)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	lines = stripRegionMarkers(lines)
+
+	if params.Indent != nil {
+		lines = reindent(lines, *params.Indent)
+	}
+
+	result := strings.Join(lines, "\n")
+	if trailingNewline {
+		result = result + "\n"
+	}
+
+	return []byte(result), nil
+}
+
+// Select lines by a comma separated list of 1 based, inclusive ranges,
+// e.g. "10-25", "3", "10-" or "1-3,7-9"
+func selectLines(lines []string, spec string) ([]string, error) {
+	selected := make([]string, 0)
+
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		start, end := 1, len(lines)
+
+		bounds := strings.SplitN(part, "-", 2)
+		var err error
+		if bounds[0] != "" {
+			start, err = strconv.Atoi(strings.TrimSpace(bounds[0]))
+			if err != nil {
+				return nil, fmt.Errorf("invalid line range %s", spec)
+			}
+		}
+
+		if len(bounds) == 1 {
+			end = start
+		} else if strings.TrimSpace(bounds[1]) != "" {
+			end, err = strconv.Atoi(strings.TrimSpace(bounds[1]))
+			if err != nil {
+				return nil, fmt.Errorf("invalid line range %s", spec)
+			}
+		}
+
+		if start < 1 || end > len(lines) || start > end {
+			return nil, fmt.Errorf("line range %s is outside of the %d lines in the file", part, len(lines))
+		}
+
+		selected = append(selected, lines[start-1:end]...)
+	}
+
+	return selected, nil
+}
+
+// Select the lines after the first line containing startAfter and before the
+// next line containing endBefore, an empty marker means the start or end
+func selectBetween(lines []string, startAfter string, endBefore string) ([]string, error) {
+	start := 0
+	if startAfter != "" {
+		start = -1
+		for i, line := range lines {
+			if strings.Contains(line, startAfter) {
+				start = i + 1
+				break
+			}
+		}
+
+		if start == -1 {
+			return nil, fmt.Errorf("start_after marker %q not found", startAfter)
+		}
+	}
+
+	end := len(lines)
+	if endBefore != "" {
+		end = -1
+		for i := start; i < len(lines); i++ {
+			if strings.Contains(lines[i], endBefore) {
+				end = i
+				break
+			}
+		}
+
+		if end == -1 {
+			return nil, fmt.Errorf("end_before marker %q not found", endBefore)
+		}
+	}
+
+	return lines[start:end], nil
+}
+
+// Select the lines between the "#region name" marker and its "#endregion",
+// regions can be nested
+func selectRegion(lines []string, name string) ([]string, error) {
+	start := -1
+	depth := 0
+
+	for i, line := range lines {
+		match := regionMarker.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+
+		// Look for the start of the region
+		if start == -1 {
+			if match[1] == "" && match[2] == name {
+				start = i + 1
+				depth = 1
+			}
+
+			continue
+		}
+
+		if match[1] == "" {
+			depth++
+			continue
+		}
+
+		// A named end marker closes its own region
+		depth--
+		if depth == 0 || match[2] == name {
+			return lines[start:i], nil
+		}
+	}
+
+	if start == -1 {
+		return nil, fmt.Errorf("region %q not found", name)
+	}
+
+	return nil, fmt.Errorf("region %q has no #endregion", name)
+}
+
+// Remove all the region marker lines
+func stripRegionMarkers(lines []string) []string {
+	result := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if !regionMarker.MatchString(line) {
+			result = append(result, line)
+		}
+	}
+
+	return result
+}
+
+// Remove the indentation all the lines have in common and indent them
+// by the given number of spaces instead
+func reindent(lines []string, indent int) []string {
+	// Find the whitespace all non blank lines start with
+	var common *string
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		prefix := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		if common == nil {
+			common = &prefix
+			continue
+		}
+
+		i := 0
+		for i < len(*common) && i < len(prefix) && (*common)[i] == prefix[i] {
+			i++
+		}
+		shorter := (*common)[:i]
+		common = &shorter
+	}
+
+	padding := ""
+	if indent > 0 {
+		padding = strings.Repeat(" ", indent)
+	}
+
+	result := make([]string, len(lines))
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			result[i] = ""
+			continue
+		}
+
+		if common != nil {
+			line = line[len(*common):]
+		}
+
+		result[i] = padding + line
+	}
+
+	return result
+}
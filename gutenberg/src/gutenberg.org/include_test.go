@@ -0,0 +1,115 @@
+package gutenberg
+
+import (
+	"testing"
+)
+
+const sample = `var mongodb = require('mongodb');
+
+MongoClient.connect(url, function(err, db) {
+    // insert
+    db.collection('test').insert({a:1}, function(err, r) {
+        db.close();
+    });
+    // done
+});
+`
+
+func intPointer(value int) *int {
+	return &value
+}
+
+func expectSelection(t *testing.T, params *langParameters, expected string) {
+	source, err := selectSource([]byte(sample), params)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+
+	if string(source) != expected {
+		t.Errorf("expected [%s] got [%s]", expected, source)
+	}
+}
+
+/**
+ * Tests
+ **/
+func TestSelectLines(t *testing.T) {
+	expectSelection(t, &langParameters{Lines: "1"}, "var mongodb = require('mongodb');\n")
+	expectSelection(t, &langParameters{Lines: "5-6"}, "    db.collection('test').insert({a:1}, function(err, r) {\n        db.close();\n")
+	expectSelection(t, &langParameters{Lines: "1,9-"}, "var mongodb = require('mongodb');\n});\n")
+
+	for _, lines := range []string{"0-2", "5-4", "8-20", "a-b"} {
+		_, err := selectSource([]byte(sample), &langParameters{Lines: lines})
+		if err == nil {
+			t.Errorf("expected an error for lines %s", lines)
+		}
+	}
+}
+
+func TestSelectBetweenMarkers(t *testing.T) {
+	expectSelection(t, &langParameters{StartAfter: "// insert", EndBefore: "// done"},
+		"    db.collection('test').insert({a:1}, function(err, r) {\n        db.close();\n    });\n")
+	expectSelection(t, &langParameters{EndBefore: "MongoClient"}, "var mongodb = require('mongodb');\n\n")
+
+	_, err := selectSource([]byte(sample), &langParameters{StartAfter: "// missing"})
+	if err == nil {
+		t.Errorf("expected an error for a missing marker")
+	}
+}
+
+func TestIndent(t *testing.T) {
+	// De-indent
+	expectSelection(t, &langParameters{StartAfter: "// insert", EndBefore: "// done", Indent: intPointer(0)},
+		"db.collection('test').insert({a:1}, function(err, r) {\n    db.close();\n});\n")
+
+	// Re-indent
+	expectSelection(t, &langParameters{Lines: "1-3", Indent: intPointer(2)},
+		"  var mongodb = require('mongodb');\n\n  MongoClient.connect(url, function(err, db) {\n")
+}
+
+const regions = `var mongodb = require('mongodb');
+// #region connect
+MongoClient.connect(url, function(err, db) {
+  /* #region insert */
+  db.collection('test').insert({a:1}, function(err, r) {
+    // #region close
+    db.close();
+    // #endregion
+  });
+  /* #endregion insert */
+});
+// #endregion connect
+`
+
+func TestSelectRegion(t *testing.T) {
+	source, err := selectSource([]byte(regions), &langParameters{Region: "insert", Indent: intPointer(0)})
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+
+	expected := "db.collection('test').insert({a:1}, function(err, r) {\n  db.close();\n});\n"
+	if string(source) != expected {
+		t.Errorf("expected [%s] got [%s]", expected, source)
+	}
+
+	// The markers are stripped from every include
+	source, err = selectSource([]byte(regions), &langParameters{})
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+
+	expected = "var mongodb = require('mongodb');\nMongoClient.connect(url, function(err, db) {\n  db.collection('test').insert({a:1}, function(err, r) {\n    db.close();\n  });\n});\n"
+	if string(source) != expected {
+		t.Errorf("expected [%s] got [%s]", expected, source)
+	}
+
+	_, err = selectSource([]byte(regions), &langParameters{Region: "missing"})
+	if err == nil {
+		t.Errorf("expected an error for a missing region")
+	}
+
+	_, err = selectSource([]byte("// #region open\nvar a;\n"), &langParameters{Region: "open"})
+	if err == nil {
+		t.Errorf("expected an error for a region without an end")
+	}
+}
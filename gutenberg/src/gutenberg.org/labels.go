@@ -0,0 +1,362 @@
+package gutenberg
+
+import (
+	"bytes"
+	"fmt"
+	blackfriday "github.com/russross/blackfriday"
+	"html"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Labels name headings, figures and code blocks so the pages of the book can
+// refer to them with [[ref:label]]. A heading is labeled with {#label} at the
+// end of its text, diagrams and code blocks with the label parameter of their
+// fence. The reference becomes a link to the label with the title of a
+// heading or the number of a figure or listing as its text, references can
+// give their own text with [[ref:label|see exercise {number}]] where {number}
+// and {title} are replaced with the number and the title of the label.
+type Label struct {
+	Name string `json:"name"`
+	// "heading", "figure" or "listing"
+	Kind string `json:"kind"`
+	// The number of the chapter for its heading, 18.2 for the second section
+	// of chapter 18 and for its second figure or listing
+	Number string `json:"number"`
+	// The text of the heading or the caption
+	Title string `json:"title"`
+	// The html file of the page the label is on, e.g. ex18.html
+	Page string `json:"page"`
+	// The markdown file of the page
+	Source string `json:"source"`
+}
+
+// A page of the book to collect the labels of
+type LabelPage struct {
+	// The markdown file of the page
+	Source string
+	// The html file the page is rendered to
+	File string
+	// The number of the chapter
+	Number int
+	// The markdown without the front matter
+	Markdown []byte
+}
+
+// The labels of the book
+type Labels struct {
+	labels map[string]*Label
+	// The numbers of the chapters by the html file of the page
+	chapters map[string]int
+	errors   []error
+}
+
+// Labels are used as ids so they are kept to letters, digits and dashes
+var labelName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9-]*$`)
+
+// Matches a label at the end of the rendered text of a heading, the LaTeX
+// renderer escapes the braces and the hash
+var headingLabel = regexp.MustCompile(`\s*\\?\{\\?#([A-Za-z0-9][A-Za-z0-9-]*)\\?\}\s*$`)
+
+// Matches the references in markdown and the code spans they can not be in
+var reference = regexp.MustCompile("(`+)[^`]+`+|\\[\\[ref:([A-Za-z0-9][A-Za-z0-9-]*)(?:\\|([^\\]]*))?\\]\\]")
+
+// The link target references are turned into
+const referencePrefix = "ref:"
+
+// The text of the links of references without a text of their own,
+// blackfriday leaves links without a text alone
+const defaultReferenceText = "{ref}"
+
+// The text of references without a text of their own
+var referenceTexts = map[string]string{
+	"heading": "{title}",
+	"figure":  "Figure {number}",
+	"listing": "Listing {number}",
+}
+
+// Collect the labels of the pages in the order of the table of contents and
+// check the references of the pages point to them
+func CollectLabels(pages []LabelPage) *Labels {
+	labels := &Labels{labels: make(map[string]*Label), chapters: make(map[string]int)}
+	for _, page := range pages {
+		labels.chapters[page.File] = page.Number
+	}
+
+	references := make([][]string, len(pages))
+	for i, page := range pages {
+		collector := &labelCollector{Renderer: blackfriday.HtmlRenderer(htmlFlags(), "", ""),
+			pageLabels: pageLabels{labels: labels, page: page.File},
+			source:     page.Source,
+			chapter:    page.Number,
+			sections:   make([]int, 7),
+		}
+		blackfriday.Markdown(prepareMarkdown(page.Markdown), collector, markdownExtensions())
+		references[i] = collector.references
+	}
+
+	// Only now every label is known
+	for i, page := range pages {
+		for _, name := range references[i] {
+			if labels.Lookup(name) == nil {
+				labels.errors = append(labels.errors, fmt.Errorf("%s: reference to unknown label %s", page.Source, name))
+			}
+		}
+	}
+
+	return labels
+}
+
+// Returns the label or nil if there is none by the name
+func (l *Labels) Lookup(name string) *Label {
+	if l == nil {
+		return nil
+	}
+
+	return l.labels[name]
+}
+
+// Returns the labels sorted by their names
+func (l *Labels) All() []*Label {
+	all := make([]*Label, 0)
+	if l == nil {
+		return all
+	}
+
+	for _, label := range l.labels {
+		all = append(all, label)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Name < all[j].Name })
+
+	return all
+}
+
+// Returns the duplicate labels and the references to unknown labels
+func (l *Labels) Errors() []error {
+	if l == nil {
+		return nil
+	}
+
+	return l.errors
+}
+
+func (l *Labels) add(label *Label) {
+	if !labelName.MatchString(label.Name) {
+		l.errors = append(l.errors, fmt.Errorf("%s: label %q can only have letters, digits and dashes", label.Source, label.Name))
+		return
+	}
+
+	if existing, ok := l.labels[label.Name]; ok {
+		l.errors = append(l.errors, fmt.Errorf("%s: label %s is already used in %s", label.Source, label.Name, existing.Source))
+		return
+	}
+
+	l.labels[label.Name] = label
+}
+
+// Returns the number of the chapter rendered to the page
+func (l *Labels) chapter(page string) (int, bool) {
+	if l == nil {
+		return 0, false
+	}
+
+	number, ok := l.chapters[page]
+	return number, ok
+}
+
+// Split the label off the rendered text of a heading
+func splitLabel(content []byte) ([]byte, string) {
+	match := headingLabel.FindSubmatchIndex(content)
+	if match == nil {
+		return content, ""
+	}
+
+	return content[:match[0]], string(content[match[2]:match[3]])
+}
+
+// Turn the references into links to the labels for blackfriday, references in
+// fenced code blocks and code spans are left alone
+func expandReferences(markdown []byte) []byte {
+	if !bytes.Contains(markdown, []byte("[[ref:")) {
+		return markdown
+	}
+
+	lines := strings.Split(string(markdown), "\n")
+	fence := ""
+	for i, line := range lines {
+		fence = trackFence(fence, line)
+		if fence != "" {
+			continue
+		}
+
+		lines[i] = reference.ReplaceAllStringFunc(line, func(match string) string {
+			groups := reference.FindStringSubmatch(match)
+			if groups[1] != "" {
+				return match
+			}
+
+			text := groups[3]
+			if text == "" {
+				text = defaultReferenceText
+			}
+
+			return fmt.Sprintf("[%s](%s%s)", text, referencePrefix, groups[2])
+		})
+	}
+
+	return []byte(strings.Join(lines, "\n"))
+}
+
+// Returns the label a link refers to if it is a reference
+func referenceName(link []byte) (string, bool) {
+	if !bytes.HasPrefix(link, []byte(referencePrefix)) {
+		return "", false
+	}
+
+	return string(link[len(referencePrefix):]), true
+}
+
+// Returns the kind of label a code block gets, diagrams with a caption or a
+// label are figures and other code blocks with one are listings
+func blockKind(lang string, params *langParameters) string {
+	if params.Caption == "" && params.Label == "" {
+		return ""
+	}
+
+	if isDiagram(lang) {
+		return "figure"
+	}
+
+	return "listing"
+}
+
+// Numbers the figures and listings of a page and resolves its references
+type pageLabels struct {
+	labels *Labels
+	// The html file of the page
+	page     string
+	figures  int
+	listings int
+}
+
+// Returns the number of the next figure or listing of the page, e.g. 15.2,
+// or "" if the chapter of the page is not known
+func (p *pageLabels) nextNumber(kind string) string {
+	chapter, ok := p.labels.chapter(p.page)
+	if !ok {
+		return ""
+	}
+
+	count := &p.figures
+	if kind == "listing" {
+		count = &p.listings
+	}
+	*count++
+
+	return fmt.Sprintf("%d.%d", chapter, *count)
+}
+
+// Returns the caption of a figure or listing with its number, e.g.
+// "Figure 15.2: Documents in a chain"
+func captionText(kind string, number string, caption string) string {
+	if number == "" {
+		return caption
+	}
+
+	text := strings.Title(kind) + " " + number
+	if caption != "" {
+		text += ": " + caption
+	}
+
+	return text
+}
+
+// Returns the link to the label of a reference and the text of the link, the
+// number and title go through escape for the output. An unknown label has no
+// link, the reference is reported when the labels are collected.
+func (p *pageLabels) reference(name string, text string, escape func(string) string) (string, string) {
+	label := p.labels.Lookup(name)
+	if label == nil {
+		if text == defaultReferenceText {
+			text = escape(name)
+		}
+
+		return "", text
+	}
+
+	if text == defaultReferenceText {
+		text = referenceTexts[label.Kind]
+	}
+
+	replacer := strings.NewReplacer("{number}", escape(label.Number), "{title}", escape(label.Title))
+	return label.Page + "#" + label.Name, replacer.Replace(text)
+}
+
+// Renders a page only to find its labels and references
+type labelCollector struct {
+	blackfriday.Renderer
+	pageLabels
+	// The markdown file and the chapter of the page
+	source  string
+	chapter int
+	// The number of headings on every level so far
+	sections []int
+	// The labels the page refers to
+	references []string
+}
+
+func (p *labelCollector) BlockCode(out *bytes.Buffer, text []byte, lang string) {
+	if _, ok := admonition(lang); ok {
+		renderAdmonitionBody(p, text)
+		return
+	}
+
+	lang, params, _ := parseLang(lang)
+	kind := blockKind(lang, params)
+	if kind == "" {
+		return
+	}
+
+	number := p.nextNumber(kind)
+	if params.Label != "" {
+		p.labels.add(&Label{Name: params.Label, Kind: kind, Number: number, Title: params.Caption, Page: p.page, Source: p.source})
+	}
+}
+
+func (p *labelCollector) Header(out *bytes.Buffer, text func() bool, level int) {
+	start := out.Len()
+	if !text() {
+		return
+	}
+
+	content, name := splitLabel(out.Bytes()[start:])
+	title := strings.TrimSpace(html.UnescapeString(tags.ReplaceAllString(string(content), "")))
+	out.Truncate(start)
+
+	// Number the sections of the chapter, 18.2.1 is the first subsection of
+	// the second section of chapter 18
+	if level >= len(p.sections) {
+		level = len(p.sections) - 1
+	}
+	p.sections[level]++
+	for i := level + 1; i < len(p.sections); i++ {
+		p.sections[i] = 0
+	}
+
+	number := strconv.Itoa(p.chapter)
+	for i := 2; i <= level; i++ {
+		number += "." + strconv.Itoa(p.sections[i])
+	}
+
+	if name != "" {
+		p.labels.add(&Label{Name: name, Kind: "heading", Number: number, Title: title, Page: p.page, Source: p.source})
+	}
+}
+
+func (p *labelCollector) Link(out *bytes.Buffer, link []byte, title []byte, content []byte) {
+	if name, ok := referenceName(link); ok {
+		p.references = append(p.references, name)
+	}
+}
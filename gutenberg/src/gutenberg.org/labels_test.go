@@ -0,0 +1,116 @@
+package gutenberg
+
+import (
+	"gutenberg.org/config"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+var labelPages = []LabelPage{
+	{Source: "ex1.md", File: "ex1.html", Number: 1, Markdown: []byte("The Setup {#setup}\n=========\n\n" +
+		"## Schema Design {#schema-design}\n\n" +
+		"```js{\"label\": \"connect\", \"caption\": \"Connecting\"}\nvar a = 1;\n```\n\n" +
+		"See [[ref:documents]] and `[[ref:not-a-reference]]`.\n")},
+	{Source: "ex2.md", File: "ex2.html", Number: 2, Markdown: []byte("# Documents\n\n" +
+		"```dot{\"caption\": \"Chain\"}\ndigraph g {}\n```\n\n" +
+		"```dot{\"label\": \"documents\", \"caption\": \"Documents\"}\ndigraph g {}\n```\n\n" +
+		"Back to [[ref:schema-design|section {number}]] and [[ref:connect]].\n")},
+}
+
+/**
+ * Tests
+ **/
+func TestCollectLabels(t *testing.T) {
+	labels := CollectLabels(labelPages)
+	if errors := labels.Errors(); len(errors) != 0 {
+		t.Fatalf("expected no errors got %v", errors)
+	}
+
+	expected := map[string]Label{
+		"setup":         {Name: "setup", Kind: "heading", Number: "1", Title: "The Setup", Page: "ex1.html", Source: "ex1.md"},
+		"schema-design": {Name: "schema-design", Kind: "heading", Number: "1.1", Title: "Schema Design", Page: "ex1.html", Source: "ex1.md"},
+		"connect":       {Name: "connect", Kind: "listing", Number: "1.1", Title: "Connecting", Page: "ex1.html", Source: "ex1.md"},
+		"documents":     {Name: "documents", Kind: "figure", Number: "2.2", Title: "Documents", Page: "ex2.html", Source: "ex2.md"},
+	}
+
+	if all := labels.All(); len(all) != len(expected) {
+		t.Errorf("expected %d labels got %d", len(expected), len(all))
+	}
+
+	for name, label := range expected {
+		if found := labels.Lookup(name); found == nil || *found != label {
+			t.Errorf("expected %v got %v", label, found)
+		}
+	}
+}
+
+func TestLabelErrors(t *testing.T) {
+	pages := append([]LabelPage{}, labelPages...)
+	pages = append(pages, LabelPage{Source: "ex3.md", File: "ex3.html", Number: 3,
+		Markdown: []byte("# Again {#setup}\n\nSee [[ref:missing]].\n")})
+
+	errors := CollectLabels(pages).Errors()
+	if len(errors) != 2 {
+		t.Fatalf("expected two errors got %v", errors)
+	}
+
+	if errors[0].Error() != "ex3.md: label setup is already used in ex1.md" {
+		t.Errorf("unexpected error %q", errors[0].Error())
+	}
+
+	if errors[1].Error() != "ex3.md: reference to unknown label missing" {
+		t.Errorf("unexpected error %q", errors[1].Error())
+	}
+}
+
+func TestReferences(t *testing.T) {
+	output, err := ioutil.TempDir("", "gutenberg-labels")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	defer os.RemoveAll(output)
+
+	c := &config.Config{OutputDirectory: output, DiagramCommand: "echo <svg/>"}
+	labels := CollectLabels(labelPages)
+
+	html := string(NewPageHtml(c, nil, "ex2.html", labels).Transform(labelPages[1].Markdown))
+	for _, expected := range []string{
+		"<figure class=\"diagram\">\n<svg/>\n<figcaption>Figure 2.1: Chain</figcaption>",
+		"<figure class=\"diagram\" id=\"documents\">\n<svg/>\n<figcaption>Figure 2.2: Documents</figcaption>",
+		"<a href=\"ex1.html#schema-design\">section 1.1</a>",
+		"<a href=\"ex1.html#connect\">Listing 1.1</a>",
+	} {
+		if !strings.Contains(html, expected) {
+			t.Errorf("expected %q in %q", expected, html)
+		}
+	}
+
+	html = string(NewSinglePageHtml(c, nil, "ex1.html", []string{"ex1.html", "ex2.html"}, labels).Transform(labelPages[0].Markdown))
+	for _, expected := range []string{
+		"<h1 id=\"ex1-setup\">The Setup</h1>",
+		"<h2 id=\"ex1-schema-design\">Schema Design</h2>",
+		"<figure class=\"listing\" id=\"ex1-connect\">\n<pre class=\"highlight\">",
+		"<figcaption>Listing 1.1: Connecting</figcaption>",
+		"<a href=\"#ex2-documents\">Figure 2.2</a>",
+		"<code>[[ref:not-a-reference]]</code>",
+	} {
+		if !strings.Contains(html, expected) {
+			t.Errorf("expected %q in %q", expected, html)
+		}
+	}
+
+	latex := string(NewLatex(c, nil, "ex1.html", "The Setup", []string{"ex1.html", "ex2.html"}, labels).Transform(labelPages[0].Markdown))
+	for _, expected := range []string{
+		"\\label{ex1-setup}\n",
+		"\\section{Schema Design}\\label{ex1-schema-design}",
+		"\\phantomsection\\label{ex1-connect}",
+		"Listing 1.1: Connecting",
+		"\\hyperref[ex2-documents]{Figure 2.2}",
+	} {
+		if !strings.Contains(latex, expected) {
+			t.Errorf("expected %q in %q", expected, latex)
+		}
+	}
+}
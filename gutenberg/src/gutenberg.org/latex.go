@@ -0,0 +1,455 @@
+package gutenberg
+
+import (
+	"bytes"
+	"fmt"
+	blackfriday "github.com/russross/blackfriday"
+	"gutenberg.org/config"
+	"html"
+	"log"
+	"regexp"
+	"strings"
+)
+
+// Create a markdown to LaTeX transformer for a page of the book, pages are the
+// files every page of the book is rendered to in the html book. The page
+// becomes one \chapter with the title, its first level one header is the
+// title of the chapter and is left out. Links between the pages and to the
+// headings point to the labels of the headings like in the single page book.
+func NewLatex(c *config.Config, logger *log.Logger, page string, title string, pages []string, labels *Labels) MarkdownTransformer {
+	if logger == nil {
+		logger = log.New(log.Writer(), log.Prefix(), log.Flags())
+	}
+
+	sections := make(map[string]string)
+	for _, other := range pages {
+		sections[other] = SectionId(other)
+	}
+
+	latexRenderer := &Latex{title: title,
+		codeIncluder: codeIncluder{config: c, logger: logger},
+		headingIds:   newHeadingIds(SectionId(page), sections),
+		pageLabels:   pageLabels{labels: labels, page: page},
+	}
+	return &CustomMarkdownTransformer{renderer: latexRenderer, extensions: markdownExtensions()}
+}
+
+type Latex struct {
+	codeIncluder
+	headingIds
+	pageLabels
+	// Title of the chapter
+	title string
+	// Set once the header with the title of the chapter was left out
+	titleSkipped bool
+	// Footnotes are numbered in the order they are listed
+	footnotes int
+	// Depth of the admonition bodies being rendered, they have no chapter
+	nested int
+}
+
+// The sectioning commands for the header levels, level one headers after the
+// title of the chapter are sections as well
+var latexSections = []string{"section", "section", "subsection", "subsubsection", "paragraph", "subparagraph"}
+
+// Matches the commands in LaTeX so the text of a header can be made into an id
+var latexCommand = regexp.MustCompile(`\\[a-zA-Z]+\*?(\[[^\]]*\])?`)
+
+// Block-level callbacks
+func (p *Latex) BlockCode(out *bytes.Buffer, text []byte, lang string) {
+	doubleSpace(out)
+
+	// Admonitions are framed with the title in bold above the body
+	if params, ok := admonition(lang); ok {
+		out.WriteString("\\begin{framed}\n\\noindent\\textbf{")
+		latexEscape(out, []byte(params.Title))
+		out.WriteString("}\n\n")
+		p.nested++
+		out.Write(renderAdmonitionBody(p, text))
+		p.nested--
+		out.WriteString("\\end{framed}\n")
+		return
+	}
+
+	// Get the code we are rendering
+	lang, params, source, err := p.blockSource(lang, text)
+	if err != nil {
+		p.logger.Printf("failed to include source for code block: %v\n", err)
+	}
+
+	// Diagrams keep their source and become figures with the caption
+	kind := blockKind(lang, params)
+	number := ""
+	if kind != "" {
+		number = p.nextNumber(kind)
+	}
+
+	if kind == "figure" {
+		out.WriteString("\\begin{figure}[htbp]\n")
+	}
+
+	if params.Label != "" {
+		out.WriteString(fmt.Sprintf("\\phantomsection\\label{%s}\n", p.labelId(params.Label)))
+	}
+
+	out.WriteString("\\begin{Verbatim}[frame=single]\n")
+	out.Write(source)
+	if len(source) > 0 && source[len(source)-1] != '\n' {
+		out.WriteByte('\n')
+	}
+	out.WriteString("\\end{Verbatim}\n")
+
+	// Numbered captions are written out so they have the numbers of the
+	// html book, LaTeX would count the chapters from one
+	caption := captionText(kind, number, params.Caption)
+	switch {
+	case kind == "figure" && number == "" && caption != "":
+		out.WriteString("\\caption{")
+		latexEscape(out, []byte(caption))
+		out.WriteString("}\n")
+	case caption != "":
+		out.WriteString("\\begin{center}\n")
+		latexEscape(out, []byte(caption))
+		out.WriteString("\n\\end{center}\n")
+	}
+
+	if kind == "figure" {
+		out.WriteString("\\end{figure}\n")
+	}
+}
+
+func (p *Latex) BlockQuote(out *bytes.Buffer, text []byte) {
+	doubleSpace(out)
+	out.WriteString("\\begin{quote}\n")
+	out.Write(text)
+	out.WriteString("\\end{quote}\n")
+}
+
+// Raw html has no place in the LaTeX book
+func (p *Latex) BlockHtml(out *bytes.Buffer, text []byte) {
+	p.logger.Printf("leaving out html block from the LaTeX output\n")
+}
+
+func (p *Latex) Header(out *bytes.Buffer, text func() bool, level int) {
+	marker := out.Len()
+	doubleSpace(out)
+
+	// Render the text first, the label is made from it
+	start := out.Len()
+	if !text() {
+		out.Truncate(marker)
+		return
+	}
+
+	content, label := splitLabel(append([]byte(nil), out.Bytes()[start:]...))
+	out.Truncate(start)
+
+	var id string
+	if label != "" {
+		id = p.labelId(label)
+	} else {
+		id = p.headingId([]byte(latexText(content)))
+	}
+
+	// The first level one header is the title of the chapter, its label
+	// points to the chapter
+	if level == 1 && !p.titleSkipped {
+		p.titleSkipped = true
+		out.Truncate(marker)
+		if label != "" {
+			out.WriteString(fmt.Sprintf("\\label{%s}\n", id))
+		}
+		return
+	}
+
+	if level > len(latexSections) {
+		level = len(latexSections)
+	}
+
+	out.WriteString(fmt.Sprintf("\\%s{", latexSections[level-1]))
+	out.Write(content)
+	out.WriteString(fmt.Sprintf("}\\label{%s}\n", id))
+}
+
+func (p *Latex) HRule(out *bytes.Buffer) {
+	doubleSpace(out)
+	out.WriteString("\\noindent\\rule{\\linewidth}{0.4pt}\n")
+}
+
+func (p *Latex) List(out *bytes.Buffer, text func() bool, flags int) {
+	marker := out.Len()
+	doubleSpace(out)
+
+	environment := "itemize"
+	if flags&blackfriday.LIST_TYPE_ORDERED != 0 {
+		environment = "enumerate"
+	}
+
+	out.WriteString(fmt.Sprintf("\\begin{%s}\n", environment))
+	if !text() {
+		out.Truncate(marker)
+		return
+	}
+	out.WriteString(fmt.Sprintf("\\end{%s}\n", environment))
+}
+
+func (p *Latex) ListItem(out *bytes.Buffer, text []byte, flags int) {
+	out.WriteString("\\item ")
+	out.Write(bytes.TrimRight(text, "\n"))
+	out.WriteString("\n")
+}
+
+func (p *Latex) Paragraph(out *bytes.Buffer, text func() bool) {
+	marker := out.Len()
+	doubleSpace(out)
+
+	if !text() {
+		out.Truncate(marker)
+		return
+	}
+	out.WriteString("\n")
+}
+
+func (p *Latex) Table(out *bytes.Buffer, header []byte, body []byte, columnData []int) {
+	doubleSpace(out)
+
+	// One column specification per column with its alignment
+	columns := bytes.NewBuffer(nil)
+	columns.WriteString("|")
+	for _, column := range columnData {
+		switch column {
+		case blackfriday.TABLE_ALIGNMENT_RIGHT:
+			columns.WriteString("r|")
+		case blackfriday.TABLE_ALIGNMENT_CENTER:
+			columns.WriteString("c|")
+		default:
+			columns.WriteString("l|")
+		}
+	}
+
+	out.WriteString(fmt.Sprintf("\\begin{tabular}{%s}\n\\hline\n", columns.String()))
+	out.Write(header)
+	out.WriteString("\\hline\n")
+	out.Write(body)
+	out.WriteString("\\hline\n\\end{tabular}\n")
+}
+
+func (p *Latex) TableRow(out *bytes.Buffer, text []byte) {
+	out.Write(text)
+	out.WriteString(" \\\\\n")
+}
+
+func (p *Latex) TableCell(out *bytes.Buffer, text []byte, flags int) {
+	if out.Len() > 0 {
+		out.WriteString(" & ")
+	}
+	out.Write(text)
+}
+
+// The notes are set at the end of the chapter with the marks in the text
+// pointing to them
+func (p *Latex) Footnotes(out *bytes.Buffer, text func() bool) {
+	marker := out.Len()
+	doubleSpace(out)
+
+	if !text() {
+		out.Truncate(marker)
+	}
+}
+
+func (p *Latex) FootnoteItem(out *bytes.Buffer, name, text []byte, flags int) {
+	p.footnotes++
+	out.WriteString(fmt.Sprintf("\\footnotetext[%d]{", p.footnotes))
+	out.Write(bytes.TrimSpace(text))
+	out.WriteString("}\n")
+}
+
+// Span-level callbacks
+func (p *Latex) AutoLink(out *bytes.Buffer, link []byte, kind int) {
+	if kind == blackfriday.LINK_TYPE_EMAIL {
+		out.WriteString("\\href{mailto:")
+		out.WriteString(latexUrl(string(link)))
+		out.WriteString("}{")
+		latexEscape(out, link)
+		out.WriteString("}")
+		return
+	}
+
+	out.WriteString("\\url{")
+	out.WriteString(latexUrl(string(link)))
+	out.WriteString("}")
+}
+
+func (p *Latex) CodeSpan(out *bytes.Buffer, text []byte) {
+	out.WriteString("\\texttt{")
+	latexEscape(out, text)
+	out.WriteString("}")
+}
+
+func (p *Latex) DoubleEmphasis(out *bytes.Buffer, text []byte) {
+	out.WriteString("\\textbf{")
+	out.Write(text)
+	out.WriteString("}")
+}
+
+func (p *Latex) Emphasis(out *bytes.Buffer, text []byte) {
+	out.WriteString("\\emph{")
+	out.Write(text)
+	out.WriteString("}")
+}
+
+func (p *Latex) Image(out *bytes.Buffer, link []byte, title []byte, alt []byte) {
+	out.WriteString("\\includegraphics[width=\\linewidth]{")
+	out.Write(bytes.TrimPrefix(link, []byte("/")))
+	out.WriteString("}")
+}
+
+func (p *Latex) LineBreak(out *bytes.Buffer) {
+	out.WriteString("\\\\\n")
+}
+
+// Links into the book become references to the labels of the headings
+func (p *Latex) Link(out *bytes.Buffer, link []byte, title []byte, content []byte) {
+	if name, ok := referenceName(link); ok {
+		// The placeholders in the text were escaped with the rest of it
+		text := latexPlaceholders.Replace(string(content))
+		target, text := p.reference(name, text, latexReplacer.Replace)
+		if target == "" {
+			p.logger.Printf("reference to unknown label %s\n", name)
+			out.WriteString(text)
+			return
+		}
+
+		link, content = []byte(target), []byte(text)
+	}
+
+	link = p.rewriteLink(link)
+	if bytes.HasPrefix(link, []byte("#")) {
+		out.WriteString(fmt.Sprintf("\\hyperref[%s]{", link[1:]))
+		out.Write(content)
+		out.WriteString("}")
+		return
+	}
+
+	out.WriteString("\\href{")
+	out.WriteString(latexUrl(string(link)))
+	out.WriteString("}{")
+	out.Write(content)
+	out.WriteString("}")
+}
+
+// Raw html has no place in the LaTeX book
+func (p *Latex) RawHtmlTag(out *bytes.Buffer, tag []byte) {
+}
+
+func (p *Latex) TripleEmphasis(out *bytes.Buffer, text []byte) {
+	out.WriteString("\\textbf{\\emph{")
+	out.Write(text)
+	out.WriteString("}}")
+}
+
+func (p *Latex) StrikeThrough(out *bytes.Buffer, text []byte) {
+	out.WriteString("\\sout{")
+	out.Write(text)
+	out.WriteString("}")
+}
+
+func (p *Latex) FootnoteRef(out *bytes.Buffer, ref []byte, id int) {
+	out.WriteString(fmt.Sprintf("\\footnotemark[%d]", id))
+}
+
+// Low-level callbacks
+func (p *Latex) Entity(out *bytes.Buffer, entity []byte) {
+	latexEscape(out, []byte(html.UnescapeString(string(entity))))
+}
+
+func (p *Latex) NormalText(out *bytes.Buffer, text []byte) {
+	latexEscape(out, text)
+}
+
+// Header and footer
+func (p *Latex) DocumentHeader(out *bytes.Buffer) {
+	if p.nested > 0 {
+		return
+	}
+
+	out.WriteString("\\chapter{")
+	latexEscape(out, []byte(p.title))
+	out.WriteString(fmt.Sprintf("}\\label{%s}\n", p.section))
+}
+
+func (p *Latex) DocumentFooter(out *bytes.Buffer) {
+}
+
+// The characters LaTeX treats specially and what to write instead
+var latexReplacer = strings.NewReplacer(
+	`\`, `\textbackslash{}`,
+	`{`, `\{`,
+	`}`, `\}`,
+	`$`, `\$`,
+	`&`, `\&`,
+	`#`, `\#`,
+	`^`, `\textasciicircum{}`,
+	`_`, `\_`,
+	`%`, `\%`,
+	`~`, `\textasciitilde{}`,
+)
+
+// Turns the escaped placeholders in the text of references back
+var latexPlaceholders = strings.NewReplacer(`\{number\}`, "{number}", `\{title\}`, "{title}", `\{ref\}`, defaultReferenceText)
+
+func latexEscape(out *bytes.Buffer, text []byte) {
+	out.WriteString(latexReplacer.Replace(string(text)))
+}
+
+// Escape the characters \href and \url do not take as they are
+func latexUrl(link string) string {
+	return strings.NewReplacer(`\`, `\\`, `#`, `\#`, `%`, `\%`, `{`, `\{`, `}`, `\}`).Replace(link)
+}
+
+// Returns the text of rendered LaTeX without the commands
+func latexText(content []byte) string {
+	text := latexCommand.ReplaceAllString(string(content), "")
+	return strings.NewReplacer(`\`, "", "{", "", "}", "").Replace(text)
+}
+
+// The packages the LaTeX renderer needs, the configured preamble comes after
+const latexPackages = `\usepackage[utf8]{inputenc}
+\usepackage[T1]{fontenc}
+\usepackage{graphicx}
+\usepackage{fancyvrb}
+\usepackage{upquote}
+\usepackage[normalem]{ulem}
+\usepackage{framed}
+\usepackage{hyperref}
+`
+
+// Put the chapters together into a complete LaTeX book with the preamble
+func LatexBook(book config.Book, preamble []byte, chapters [][]byte) []byte {
+	out := bytes.NewBuffer(nil)
+	out.WriteString("\\documentclass{book}\n")
+	out.WriteString(latexPackages)
+	out.Write(preamble)
+	if len(preamble) > 0 && preamble[len(preamble)-1] != '\n' {
+		out.WriteByte('\n')
+	}
+
+	out.WriteString("\n\\title{")
+	latexEscape(out, []byte(book.Title))
+	if book.Subtitle != "" {
+		out.WriteString("\\\\\n\\large ")
+		latexEscape(out, []byte(book.Subtitle))
+	}
+	out.WriteString("}\n\\author{")
+	latexEscape(out, []byte(book.Author))
+	out.WriteString("}\n\\date{}\n\n")
+
+	out.WriteString("\\begin{document}\n\\maketitle\n\\tableofcontents\n")
+	for _, chapter := range chapters {
+		out.WriteString("\n")
+		out.Write(chapter)
+	}
+	out.WriteString("\n\\end{document}\n")
+
+	return out.Bytes()
+}
@@ -0,0 +1,93 @@
+package gutenberg
+
+import (
+	"gutenberg.org/config"
+	"testing"
+)
+
+/**
+ * Tests
+ **/
+func TestLatexBook(t *testing.T) {
+	markdown := "Exercise 1: The Setup\n" +
+		"=====================\n\n" +
+		"Install **node** & _mongo_ from [nodejs](http://nodejs.org/#download), see [queries](ex2.html#queries) and [usage](#usage-100).\n\n" +
+		"## Usage 100%\n\n" +
+		"* one\n" +
+		"* two `$x_1`\n\n" +
+		"Then\n\n" +
+		"```js\n" +
+		"var a = {b: 1};\n" +
+		"```\n\n" +
+		"| Name | Value |\n" +
+		"|:-----|------:|\n" +
+		"| a    | 1     |\n\n" +
+		"> quoted\n\n" +
+		"!!! warning \"Mind the $\"\n" +
+		"    Slow on **big** collections.\n\n" +
+		"<div class=\"note\">left out</div>\n"
+
+	chapter := NewLatex(&config.Config{}, nil, "ex1.html", "The Setup", []string{"ex1.html", "ex2.html"}, nil).Transform([]byte(markdown))
+	tex := LatexBook(config.Book{Title: "Learn Node & MongoDB", Author: "Christian"}, []byte("\\usepackage{palatino}"), [][]byte{chapter})
+
+	expected := `\documentclass{book}
+\usepackage[utf8]{inputenc}
+\usepackage[T1]{fontenc}
+\usepackage{graphicx}
+\usepackage{fancyvrb}
+\usepackage{upquote}
+\usepackage[normalem]{ulem}
+\usepackage{framed}
+\usepackage{hyperref}
+\usepackage{palatino}
+
+\title{Learn Node \& MongoDB}
+\author{Christian}
+\date{}
+
+\begin{document}
+\maketitle
+\tableofcontents
+
+\chapter{The Setup}\label{ex1}
+
+Install \textbf{node} \& \emph{mongo} from \href{http://nodejs.org/\#download}{nodejs}, see \hyperref[ex2-queries]{queries} and \hyperref[ex1-usage-100]{usage}.
+
+\section{Usage 100\%}\label{ex1-usage-100}
+
+\begin{itemize}
+\item one
+\item two \texttt{\$x\_1}
+\end{itemize}
+
+Then
+
+\begin{Verbatim}[frame=single]
+var a = {b: 1};
+\end{Verbatim}
+
+\begin{tabular}{|l|r|}
+\hline
+Name & Value \\
+\hline
+a & 1 \\
+\hline
+\end{tabular}
+
+\begin{quote}
+quoted
+\end{quote}
+
+\begin{framed}
+\noindent\textbf{Mind the \$}
+
+Slow on \textbf{big} collections.
+\end{framed}
+
+\end{document}
+`
+
+	if string(tex) != expected {
+		t.Errorf("expected [%s] got [%s]", expected, tex)
+	}
+}
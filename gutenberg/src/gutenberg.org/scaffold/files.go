@@ -0,0 +1,203 @@
+package scaffold
+
+// The files of a new book by their path relative to the book
+var Files = map[string]string{
+	"config.json": `{
+	"book": {
+		"title": {{BookTitle}},
+		"description": "",
+		"language": "en"
+	},
+	"table_of_contents": [
+		{"file": "chapter1.md"}
+	],
+	"layouts": {
+		"html": {
+			"index": "layouts/index.gtl",
+			"page": "layouts/page.gtl"
+		}
+	},
+	"assets": [
+		"assets/css/page.css"
+	],
+	"output_directory": "./output",
+	"highlight_theme": "tango",
+	"default_output_format": "html",
+	"first_chapter": 1
+}
+`,
+
+	"layouts/index.gtl": `<html>
+	<head>
+		<meta charset="utf-8">
+		<title>{{.Book.Title}}</title>
+		<link rel="stylesheet" type="text/css" href="./page.css">
+	</head>
+	<body>
+		<div id="content">
+			<h1>{{.Book.Title}}</h1>
+			{{if .Book.Subtitle}}<h2>{{.Book.Subtitle}}</h2>{{end}}
+			{{if .Book.Author}}<p class="author">{{.Book.Author}}</p>{{end}}
+			{{if .Book.Description}}<p class="description">{{.Book.Description}}</p>{{end}}
+			<h2>Chapters</h2>
+			{{range .TableOfContents}}
+				<p><a href="./{{.File}}">{{.Number}} {{.Title}}</a></p>
+			{{end}}
+		</div>
+	</body>
+</html>
+`,
+
+	"layouts/page.gtl": `<html>
+	<head>
+		<meta charset="utf-8">
+		<title>{{with .Current}}{{.Title}} - {{end}}{{.Book.Title}}</title>
+		<link rel="stylesheet" type="text/css" href="./page.css">
+		<link rel="stylesheet" type="text/css" href="./highlight.css">
+	</head>
+	<body>
+		<div id="index">
+			<h1><a href="./index.html">{{.Book.Title}}</a></h1>
+			<div id="search">
+				<input type="search" id="search-input" placeholder="Search the book">
+				<div id="search-results"></div>
+			</div>
+			{{range .TableOfContents}}
+				<p{{if .Active}} class="active"{{end}}><a href="./{{.File}}">{{.Number}} {{.Title}}</a></p>
+			{{end}}
+		</div>
+		<div id="content">
+			{{.Page}}
+			<div id="navigation">
+				{{with .Previous}}<a class="previous" href="./{{.File}}">&larr; {{.Title}}</a>{{end}}
+				{{with .Next}}<a class="next" href="./{{.File}}">{{.Title}} &rarr;</a>{{end}}
+			</div>
+		</div>
+		<script src="./search_index.js"></script>
+		<script src="./search.js"></script>
+	</body>
+</html>
+`,
+
+	"assets/css/page.css": `body {
+	font-family: sans-serif;
+	margin: 0;
+}
+
+#index {
+	float: left;
+	width: 20%;
+	padding: 0 20px 0 20px;
+	box-sizing: border-box;
+}
+
+#index .active a {
+	font-weight: bold;
+	color: black;
+}
+
+#content {
+	float: left;
+	width: 80%;
+	padding: 0 20px 0 20px;
+	box-sizing: border-box;
+}
+
+pre.highlight {
+	padding: 10px;
+	overflow: auto;
+}
+
+#navigation {
+	clear: both;
+	padding: 20px 0 20px 0;
+}
+
+#navigation .next {
+	float: right;
+}
+
+#search input {
+	width: 100%;
+	box-sizing: border-box;
+}
+
+#search .search-result p {
+	margin-top: 0;
+	font-size: small;
+	color: gray;
+}
+
+.admonition {
+	margin: 20px 0 20px 0;
+	border: 1px solid lightgray;
+}
+
+.admonition .admonition_title {
+	padding: 5px;
+	font-weight: bold;
+	background-color: lightgray;
+}
+
+.admonition .admonition_body {
+	padding: 0 10px 0 10px;
+}
+
+.admonition.warning {
+	border-color: orange;
+}
+
+.admonition.warning .admonition_title {
+	background-color: orange;
+}
+
+.listing {
+	margin: 20px 0 20px 0;
+}
+
+.listing figcaption {
+	font-style: italic;
+}
+`,
+
+	"chapter1.md": `---
+title: Getting Started
+description: The first chapter of the book
+---
+Getting Started {#getting-started}
+===============
+
+Every chapter is a markdown file listed in the ` + "`table_of_contents`" + ` of
+` + "`config.json`" + `. Code can be written straight into the chapter
+
+` + "```js" + `
+console.log("Hello");
+` + "```" + `
+
+or included from a file so it can be run and tested on its own.
+
+` + "```js{\"file\":\"/code/chapter1/hello.js\"}\n```" + `
+
+Only a region of the file can be included as well, with a label and a caption
+it becomes a numbered listing.
+
+` + "```js{\"file\":\"/code/chapter1/hello.js\",\"region\":\"greet\",\"label\":\"greet\",\"caption\":\"Greeting\"}\n```" + `
+
+Headings are labeled with ` + "`{#label}`" + ` at the end, ` + "`[[ref:greet]]`" + `
+turns into a link to [[ref:greet]] with its number and ` + "`[[ref:getting-started]]`" + `
+into one to [[ref:getting-started]].
+
+!!! note "Admonitions"
+    Notes and warnings are set apart from the text with ` + "`!!! note`" + `
+    and an indented body, or between ` + "`:::warning`" + ` and ` + "`:::`" + `.
+`,
+
+	"code/chapter1/hello.js": `// #region greet
+var greet = function(name) {
+  return "Hello " + name;
+}
+// #endregion greet
+
+console.log(greet("World"));
+`,
+}
@@ -0,0 +1,58 @@
+package scaffold
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Write the skeleton of a new book into dir, which must not exist or be
+// empty. Returns the files written relative to dir.
+func Create(dir string, title string) ([]string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err == nil && len(entries) > 0 {
+		return nil, fmt.Errorf("%s already exists and is not empty", dir)
+	}
+
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	// Default the title to the name of the directory
+	if title == "" {
+		absolute, _ := filepath.Abs(dir)
+		title = filepath.Base(absolute)
+	}
+
+	quotedTitle, err := json.Marshal(title)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]string, 0, len(Files))
+	for name := range Files {
+		files = append(files, name)
+	}
+	sort.Strings(files)
+
+	for _, name := range files {
+		content := strings.Replace(Files[name], "{{BookTitle}}", string(quotedTitle), -1)
+		file := filepath.Join(dir, filepath.FromSlash(name))
+
+		err = os.MkdirAll(filepath.Dir(file), 0755)
+		if err != nil {
+			return nil, err
+		}
+
+		err = ioutil.WriteFile(file, []byte(content), 0644)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return files, nil
+}
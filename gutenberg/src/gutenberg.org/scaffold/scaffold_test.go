@@ -0,0 +1,50 @@
+package scaffold
+
+import (
+	"gutenberg.org/config"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+/**
+ * Tests
+ **/
+func TestCreate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gutenberg-new")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	defer os.RemoveAll(dir)
+
+	book := dir + "/my-book"
+	files, err := Create(book, "A \"Quoted\" Book")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+
+	if len(files) != len(Files) {
+		t.Errorf("expected %d files got %v", len(Files), files)
+	}
+
+	// The configuration has to read and validate cleanly
+	cfgfile := ""
+	c, err := config.ReadConfigFromFile(&cfgfile, &book)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+
+	if c.Book.Title != "A \"Quoted\" Book" {
+		t.Errorf("unexpected title [%s]", c.Book.Title)
+	}
+
+	if problems := config.Validate(c, book); len(problems) > 0 {
+		t.Errorf("expected no problems got %v", problems)
+	}
+
+	// Never write over an existing book
+	_, err = Create(book, "")
+	if err == nil {
+		t.Errorf("expected an error creating a book in a directory that is not empty")
+	}
+}
@@ -0,0 +1,286 @@
+package search
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// The search index in the output directory
+const IndexFile = "search.json"
+
+// The search index as a script that sets searchIndex, browsers do not let
+// pages opened from the disk read the json
+const ScriptFile = "search_index.js"
+
+// The script that searches the index as the reader types, the layouts load it
+// after the index
+const ClientFile = "search.js"
+
+//go:embed search.js
+var client []byte
+
+// Bumped whenever the layout of the index changes
+const indexVersion = 1
+
+type Heading struct {
+	Title string `json:"title"`
+	// The page and the id of the heading, e.g. ex1.html#installing-node
+	Anchor string `json:"anchor"`
+}
+
+// What can be searched for on a page
+type Document struct {
+	// The markdown file the page is rendered from
+	Source string `json:"source"`
+	// The page the document links to
+	File     string    `json:"file"`
+	Title    string    `json:"title"`
+	Headings []Heading `json:"headings"`
+	// The text of the page without its code blocks
+	Text string `json:"text"`
+	// The names used in the code blocks of the page
+	Identifiers []string `json:"identifiers"`
+}
+
+// The documents of all the pages of the book
+type Index struct {
+	Version   int         `json:"version"`
+	Documents []*Document `json:"documents"`
+
+	// Protects the documents while pages are rendered in parallel
+	lock sync.Mutex
+}
+
+// Read the index of the last build from the output directory so pages that
+// are up to date keep their documents, a missing or outdated index is empty
+func LoadIndex(outputDirectory string) *Index {
+	index := &Index{Version: indexVersion, Documents: make([]*Document, 0)}
+
+	data, err := ioutil.ReadFile(filepath.Join(outputDirectory, IndexFile))
+	if err != nil {
+		return index
+	}
+
+	stored := &Index{}
+	err = json.Unmarshal(data, stored)
+	if err != nil || stored.Version != indexVersion || stored.Documents == nil {
+		return index
+	}
+
+	index.Documents = stored.Documents
+	return index
+}
+
+// Returns true if the index has a document for the page
+func (i *Index) Has(source string) bool {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	for _, document := range i.Documents {
+		if document.Source == source {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Add the document of a page, replacing the one the page had
+func (i *Index) Add(document *Document) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	for n, existing := range i.Documents {
+		if existing.Source == document.Source {
+			i.Documents[n] = document
+			return
+		}
+	}
+
+	i.Documents = append(i.Documents, document)
+}
+
+// Only keep the documents of the pages in the order they are given, pages
+// that were removed from the book drop out of the index
+func (i *Index) Keep(sources []string) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	documents := make([]*Document, 0, len(sources))
+	for _, source := range sources {
+		for _, document := range i.Documents {
+			if document.Source == source {
+				documents = append(documents, document)
+				break
+			}
+		}
+	}
+
+	i.Documents = documents
+}
+
+// Write the index and the script with the index to the output directory,
+// files that did not change are left alone
+func (i *Index) Write(outputDirectory string) error {
+	i.lock.Lock()
+	data, err := json.Marshal(i)
+	i.lock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	_, err = writeChanged(filepath.Join(outputDirectory, IndexFile), data)
+	if err != nil {
+		return err
+	}
+
+	script := append([]byte("var searchIndex = "), data...)
+	script = append(script, ";\n"...)
+	_, err = writeChanged(filepath.Join(outputDirectory, ScriptFile), script)
+	return err
+}
+
+// Write the script that searches the index to the output directory, returns
+// true if the script changed
+func WriteClient(outputDirectory string) (bool, error) {
+	return writeChanged(filepath.Join(outputDirectory, ClientFile), client)
+}
+
+// Write a file unless it already has the content, returns true if it was
+// written
+func writeChanged(file string, content []byte) (bool, error) {
+	existing, err := ioutil.ReadFile(file)
+	if err == nil && bytes.Equal(existing, content) {
+		return false, nil
+	}
+
+	return true, ioutil.WriteFile(file, content, 0644)
+}
+
+// Matches the names in code
+var identifier = regexp.MustCompile(`[A-Za-z_$][A-Za-z0-9_$]*`)
+
+// Keywords are in every code block, searching for them finds nothing useful
+var keywords = map[string]bool{
+	"var": true, "function": true, "return": true, "new": true, "this": true,
+	"true": true, "false": true, "null": true, "undefined": true, "for": true,
+	"while": true, "else": true, "typeof": true, "instanceof": true, "delete": true,
+	"try": true, "catch": true, "throw": true, "break": true, "continue": true,
+	"switch": true, "case": true, "default": true, "let": true, "const": true,
+}
+
+// The elements whose text is not run together with the text after them
+var blocks = map[string]bool{
+	"p": true, "div": true, "li": true, "td": true, "th": true, "tr": true,
+	"blockquote": true, "figcaption": true, "h1": true, "h2": true, "h3": true,
+	"h4": true, "h5": true, "h6": true, "br": true, "dt": true, "dd": true,
+}
+
+// Build the document of a page from its rendered html, so code included from
+// files is searchable as well
+func Extract(source string, file string, title string, html []byte) *Document {
+	document := &Document{Source: source, File: file, Title: title,
+		Headings:    make([]Heading, 0),
+		Identifiers: make([]string, 0),
+	}
+
+	decoder := xml.NewDecoder(io.MultiReader(strings.NewReader("<div>"), bytes.NewReader(html), strings.NewReader("</div>")))
+	decoder.Strict = false
+	decoder.AutoClose = xml.HTMLAutoClose
+	decoder.Entity = xml.HTMLEntity
+
+	text := bytes.NewBuffer(nil)
+	code := bytes.NewBuffer(nil)
+	// The heading being read and its id
+	var heading *bytes.Buffer
+	var headingId string
+	// Depth of the code blocks and the diagrams we are in
+	inCode, inSvg := 0, 0
+
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch strings.ToLower(t.Name.Local) {
+			case "pre":
+				inCode++
+			case "svg", "script", "style":
+				inSvg++
+			case "h1", "h2", "h3", "h4", "h5", "h6":
+				heading = bytes.NewBuffer(nil)
+				headingId = attribute(t, "id")
+			}
+		case xml.EndElement:
+			switch strings.ToLower(t.Name.Local) {
+			case "pre":
+				inCode--
+				code.WriteByte('\n')
+			case "svg", "script", "style":
+				inSvg--
+			case "h1", "h2", "h3", "h4", "h5", "h6":
+				if heading != nil && headingId != "" {
+					document.Headings = append(document.Headings, Heading{Title: collapse(heading.String()), Anchor: file + "#" + headingId})
+				}
+				heading = nil
+			}
+
+			// Keep the words of neighbouring blocks apart
+			if blocks[strings.ToLower(t.Name.Local)] {
+				text.WriteByte(' ')
+			}
+		case xml.CharData:
+			switch {
+			case inSvg > 0:
+			case inCode > 0:
+				code.Write(t)
+			default:
+				text.Write(t)
+				if heading != nil {
+					heading.Write(t)
+				}
+			}
+		}
+	}
+
+	document.Text = collapse(text.String())
+
+	seen := make(map[string]bool)
+	for _, name := range identifier.FindAllString(code.String(), -1) {
+		if len(name) < 3 || keywords[name] || seen[name] {
+			continue
+		}
+
+		seen[name] = true
+		document.Identifiers = append(document.Identifiers, name)
+	}
+
+	return document
+}
+
+// Returns the value of an attribute of an element
+func attribute(element xml.StartElement, name string) string {
+	for _, attr := range element.Attr {
+		if strings.ToLower(attr.Name.Local) == name {
+			return attr.Value
+		}
+	}
+
+	return ""
+}
+
+// Collapse the runs of whitespace into single spaces
+func collapse(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
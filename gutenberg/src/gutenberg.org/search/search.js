@@ -0,0 +1,130 @@
+// Searches the pages of the book as the reader types. Gutenberg writes this
+// script and the index in search_index.js next to the pages so no server is
+// needed.
+(function() {
+	var input = document.getElementById("search-input");
+	var results = document.getElementById("search-results");
+	if (!input || !results || !window.searchIndex) {
+		return;
+	}
+
+	var documents = window.searchIndex.documents;
+
+	// Count the times a word is in the text, counting stops at five
+	var occurrences = function(text, word) {
+		var count = 0;
+		var position = text.indexOf(word);
+		while (position != -1 && count < 5) {
+			count++;
+			position = text.indexOf(word, position + word.length);
+		}
+		return count;
+	};
+
+	// Score a page for the words, every word has to be on the page. Returns
+	// null for pages without all the words.
+	var match = function(doc, words) {
+		var result = {doc: doc, score: 0, href: doc.file, heading: null};
+		var title = doc.title.toLowerCase();
+		var text = doc.text.toLowerCase();
+
+		for (var i = 0; i < words.length; i++) {
+			var word = words[i];
+			var score = 0;
+
+			if (title.indexOf(word) != -1) {
+				score += 10;
+			}
+
+			for (var j = 0; j < doc.headings.length; j++) {
+				if (doc.headings[j].title.toLowerCase().indexOf(word) != -1) {
+					score += 5;
+					// Link to the first heading that matches below the title
+					if (!result.heading && doc.headings[j].title != doc.title) {
+						result.heading = doc.headings[j];
+						result.href = doc.headings[j].anchor;
+					}
+				}
+			}
+
+			for (var k = 0; k < doc.identifiers.length; k++) {
+				var name = doc.identifiers[k].toLowerCase();
+				if (name == word) {
+					score += 4;
+				} else if (name.indexOf(word) == 0) {
+					score += 2;
+				}
+			}
+
+			score += occurrences(text, word);
+			if (score == 0) {
+				return null;
+			}
+
+			result.score += score;
+		}
+
+		return result;
+	};
+
+	// The text around the first word found on the page
+	var snippet = function(doc, words) {
+		var text = doc.text.toLowerCase();
+		for (var i = 0; i < words.length; i++) {
+			var position = text.indexOf(words[i]);
+			if (position != -1) {
+				var start = Math.max(0, position - 60);
+				return (start > 0 ? "..." : "") + doc.text.substr(start, 160) + "...";
+			}
+		}
+		return doc.text.substr(0, 160) + "...";
+	};
+
+	var search = function() {
+		results.innerHTML = "";
+
+		var words = input.value.toLowerCase().split(/\s+/).filter(function(word) {
+			return word.length > 0;
+		});
+		if (words.length == 0) {
+			return;
+		}
+
+		var found = [];
+		for (var i = 0; i < documents.length; i++) {
+			var result = match(documents[i], words);
+			if (result) {
+				found.push(result);
+			}
+		}
+
+		found.sort(function(a, b) {
+			return b.score - a.score;
+		});
+
+		if (found.length == 0) {
+			var nothing = document.createElement("p");
+			nothing.textContent = "Nothing found";
+			results.appendChild(nothing);
+			return;
+		}
+
+		for (var j = 0; j < found.length && j < 10; j++) {
+			var entry = document.createElement("div");
+			entry.className = "search-result";
+
+			var link = document.createElement("a");
+			link.href = "./" + found[j].href;
+			link.textContent = found[j].doc.title + (found[j].heading ? " - " + found[j].heading.title : "");
+			entry.appendChild(link);
+
+			var text = document.createElement("p");
+			text.textContent = snippet(found[j].doc, words);
+			entry.appendChild(text);
+
+			results.appendChild(entry);
+		}
+	};
+
+	input.addEventListener("input", search);
+})();
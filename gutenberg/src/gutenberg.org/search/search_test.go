@@ -0,0 +1,86 @@
+package search
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+/**
+ * Tests
+ **/
+func TestExtract(t *testing.T) {
+	html := "<h1 id=\"the-setup\">The Setup</h1>\n\n" +
+		"<p>Install <strong>node</strong> &amp; mongo, it&rsquo;s easy.</p>\n\n" +
+		"<h2 id=\"usage\">Usage <code>db.find</code></h2>\n\n" +
+		"<pre class=\"highlight\"><code class=\"js\"><span class=\"k\">var</span> client = require(<span class=\"s\">'mongodb'</span>).MongoClient;\n" +
+		"client.connect(url, function(err, db) {});\n</code></pre>\n\n" +
+		"<figure class=\"diagram\">\n<svg><text>node0</text></svg>\n<figcaption>Documents</figcaption>\n</figure>\n"
+
+	document := Extract("ex1.md", "ex1.html", "The Setup", []byte(html))
+
+	expectedHeadings := []Heading{
+		{Title: "The Setup", Anchor: "ex1.html#the-setup"},
+		{Title: "Usage db.find", Anchor: "ex1.html#usage"},
+	}
+	if !reflect.DeepEqual(document.Headings, expectedHeadings) {
+		t.Errorf("expected %v got %v", expectedHeadings, document.Headings)
+	}
+
+	expectedText := "The Setup Install node & mongo, it’s easy. Usage db.find Documents"
+	if document.Text != expectedText {
+		t.Errorf("expected %q got %q", expectedText, document.Text)
+	}
+
+	expectedIdentifiers := []string{"client", "require", "mongodb", "MongoClient", "connect", "url", "err"}
+	if !reflect.DeepEqual(document.Identifiers, expectedIdentifiers) {
+		t.Errorf("expected %v got %v", expectedIdentifiers, document.Identifiers)
+	}
+}
+
+func TestIndex(t *testing.T) {
+	output, err := ioutil.TempDir("", "gutenberg-search")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	defer os.RemoveAll(output)
+
+	index := LoadIndex(output)
+	index.Add(&Document{Source: "ex1.md", Title: "One"})
+	index.Add(&Document{Source: "ex0.md", Title: "Zero"})
+	index.Add(&Document{Source: "ex1.md", Title: "First"})
+	index.Keep([]string{"ex0.md", "ex1.md", "ex2.md"})
+
+	err = index.Write(output)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+
+	loaded := LoadIndex(output)
+	if len(loaded.Documents) != 2 || loaded.Documents[0].Title != "Zero" || loaded.Documents[1].Title != "First" {
+		t.Errorf("unexpected documents %v", loaded.Documents)
+	}
+
+	if !loaded.Has("ex1.md") || loaded.Has("ex2.md") {
+		t.Errorf("expected only the pages that were added to be in the index")
+	}
+}
+
+func TestWriteClient(t *testing.T) {
+	output, err := ioutil.TempDir("", "gutenberg-search")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	defer os.RemoveAll(output)
+
+	changed, err := WriteClient(output)
+	if err != nil || !changed {
+		t.Fatalf("expected the script to be written got %v %q", changed, err)
+	}
+
+	changed, err = WriteClient(output)
+	if err != nil || changed {
+		t.Errorf("expected the unchanged script to be left alone got %v %q", changed, err)
+	}
+}
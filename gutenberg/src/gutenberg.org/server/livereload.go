@@ -0,0 +1,163 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+const (
+	liveReloadScriptPath = "/__gutenberg/livereload.js"
+	liveReloadEventsPath = "/__gutenberg/livereload"
+)
+
+// The client connects to the event stream and either swaps the stylesheets
+// or reloads the page when the files it depends on are rewritten
+const liveReloadScript = `(function() {
+	var source = new EventSource("` + liveReloadEventsPath + `");
+	var current = window.location.pathname;
+	if (current.charAt(current.length - 1) == "/") {
+		current = current + "index.html";
+	}
+
+	source.onmessage = function(event) {
+		var files = JSON.parse(event.data);
+		var reload = false;
+		var swapCss = false;
+
+		for (var i = 0; i < files.length; i++) {
+			if (/\.css$/.test(files[i])) {
+				swapCss = true;
+			} else if (files[i] == current || !/\.html$/.test(files[i])) {
+				reload = true;
+			}
+		}
+
+		if (reload) {
+			window.location.reload();
+			return;
+		}
+
+		if (swapCss) {
+			var links = document.querySelectorAll("link[rel=stylesheet]");
+			for (var i = 0; i < links.length; i++) {
+				var href = links[i].getAttribute("href").replace(/[?&]livereload=\d+/, "");
+				links[i].setAttribute("href", href + (href.indexOf("?") == -1 ? "?" : "&") + "livereload=" + Date.now());
+			}
+		}
+	};
+})();
+`
+
+var liveReloadTag = []byte(`<script type="text/javascript" src="` + liveReloadScriptPath + `"></script>`)
+
+// Keeps track of the browsers connected to the live reload event stream
+type liveReload struct {
+	sync.Mutex
+	clients map[chan []byte]bool
+	closed  bool
+}
+
+func newLiveReload() *liveReload {
+	return &liveReload{clients: make(map[chan []byte]bool)}
+}
+
+// Tell all the connected browsers which files were rewritten
+func (l *liveReload) broadcast(files []string) {
+	data, err := json.Marshal(files)
+	if err != nil {
+		return
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	for client := range l.clients {
+		// Never block the build on a slow browser
+		select {
+		case client <- data:
+		default:
+		}
+	}
+}
+
+// Disconnect all the browsers
+func (l *liveReload) close() {
+	l.Lock()
+	defer l.Unlock()
+
+	l.closed = true
+	for client := range l.clients {
+		close(client)
+		delete(l.clients, client)
+	}
+}
+
+func (l *liveReload) serveEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	// Register the browser
+	client := make(chan []byte, 16)
+	l.Lock()
+	if l.closed {
+		l.Unlock()
+		http.Error(w, "server shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	l.clients[client] = true
+	l.Unlock()
+
+	defer func() {
+		l.Lock()
+		if l.clients[client] {
+			delete(l.clients, client)
+			close(client)
+		}
+		l.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case data, ok := <-client:
+			if !ok {
+				return
+			}
+
+			fmt.Fprintf(w, "data: %s\n\n", data)
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func serveLiveReloadScript(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/javascript")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write([]byte(liveReloadScript))
+}
+
+// Add the live reload client to a html page, just before the closing body
+// tag if there is one
+func injectLiveReload(page []byte) []byte {
+	index := bytes.LastIndex(bytes.ToLower(page), []byte("</body>"))
+	if index == -1 {
+		return append(page, liveReloadTag...)
+	}
+
+	result := make([]byte, 0, len(page)+len(liveReloadTag))
+	result = append(result, page[:index]...)
+	result = append(result, liveReloadTag...)
+	return append(result, page[index:]...)
+}
@@ -0,0 +1,215 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+func init() {
+	// Make sure we serve the book formats with the right content types
+	// even on systems without a complete mime.types file
+	mime.AddExtensionType(".css", "text/css; charset=utf-8")
+	mime.AddExtensionType(".html", "text/html; charset=utf-8")
+	mime.AddExtensionType(".xhtml", "application/xhtml+xml; charset=utf-8")
+	mime.AddExtensionType(".js", "application/javascript")
+	mime.AddExtensionType(".json", "application/json")
+	mime.AddExtensionType(".svg", "image/svg+xml")
+	mime.AddExtensionType(".epub", "application/epub+zip")
+	mime.AddExtensionType(".tex", "text/plain; charset=utf-8")
+}
+
+const notFoundPage = `<html>
+	<head><title>404 Not Found</title></head>
+	<body>
+		<h1>404 Not Found</h1>
+		<p>The page %s does not exist in the book.</p>
+	</body>
+</html>
+`
+
+// A (very) simple web server that serves a generated book from its
+// output directory
+type Server struct {
+	// Directory we serve files from
+	Root string
+	// Port to listen on
+	Port string
+	// Inject the live reload client into html pages
+	LiveReload bool
+
+	server     *http.Server
+	liveReload *liveReload
+}
+
+func NewServer(root string, port string) *Server {
+	s := &Server{Root: root, Port: port, liveReload: newLiveReload()}
+	s.server = &http.Server{Addr: ":" + port, Handler: s}
+	// Disconnect the browsers or shutting down would wait on them
+	s.server.RegisterOnShutdown(s.liveReload.close)
+	return s
+}
+
+// Tell the browsers that files in the output directory were rewritten,
+// the paths are relative to the root
+func (s *Server) Reload(files []string) {
+	if !s.LiveReload || len(files) == 0 {
+		return
+	}
+
+	paths := make([]string, 0, len(files))
+	for _, file := range files {
+		paths = append(paths, path.Clean("/"+filepath.ToSlash(file)))
+	}
+
+	s.liveReload.broadcast(paths)
+}
+
+// Listen for requests until the server is shut down
+func (s *Server) ListenAndServe() error {
+	err := s.server.ListenAndServe()
+	if err == http.ErrServerClosed {
+		return nil
+	}
+
+	return err
+}
+
+// Stop accepting new requests and wait for the running ones to finish
+func (s *Server) Shutdown() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return s.server.Shutdown(ctx)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.LiveReload {
+		switch r.URL.Path {
+		case liveReloadScriptPath:
+			serveLiveReloadScript(w, r)
+			return
+		case liveReloadEventsPath:
+			s.liveReload.serveEvents(w, r)
+			return
+		}
+	}
+
+	// Clean up the path so we never leave the root directory
+	urlPath := path.Clean("/" + r.URL.Path)
+	fileName := filepath.Join(s.Root, filepath.FromSlash(urlPath))
+
+	fileInfo, err := os.Stat(fileName)
+	if err != nil {
+		s.notFound(w, r)
+		return
+	}
+
+	if fileInfo.IsDir() {
+		// Make sure relative links in the index resolve inside the directory
+		if len(r.URL.Path) == 0 || r.URL.Path[len(r.URL.Path)-1] != '/' {
+			http.Redirect(w, r, r.URL.Path+"/", http.StatusMovedPermanently)
+			return
+		}
+
+		// Serve the index page if there is one
+		indexFile := filepath.Join(fileName, "index.html")
+		indexFileInfo, err := os.Stat(indexFile)
+		if err == nil && !indexFileInfo.IsDir() {
+			s.serveFile(w, r, indexFile, indexFileInfo)
+			return
+		}
+
+		s.listDirectory(w, r, fileName)
+		return
+	}
+
+	s.serveFile(w, r, fileName, fileInfo)
+}
+
+func (s *Server) serveFile(w http.ResponseWriter, r *http.Request, fileName string, fileInfo os.FileInfo) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		s.notFound(w, r)
+		return
+	}
+	defer file.Close()
+
+	// Set the content type from the extension, ServeContent sniffs the rest
+	contentType := mime.TypeByExtension(filepath.Ext(fileName))
+	if contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+
+	// Never cache, the book changes under us while editing
+	w.Header().Set("Cache-Control", "no-cache")
+
+	// Add the live reload client on the fly so it never ends up on disk
+	if s.LiveReload && (filepath.Ext(fileName) == ".html" || filepath.Ext(fileName) == ".htm") {
+		page, err := ioutil.ReadAll(file)
+		if err != nil {
+			s.notFound(w, r)
+			return
+		}
+
+		http.ServeContent(w, r, fileInfo.Name(), fileInfo.ModTime(), bytes.NewReader(injectLiveReload(page)))
+		return
+	}
+
+	http.ServeContent(w, r, fileInfo.Name(), fileInfo.ModTime(), file)
+}
+
+func (s *Server) listDirectory(w http.ResponseWriter, r *http.Request, dirName string) {
+	fileInfos, err := ioutil.ReadDir(dirName)
+	if err != nil {
+		s.notFound(w, r)
+		return
+	}
+
+	// Sort the files by name
+	names := make([]string, 0, len(fileInfos))
+	for _, fileInfo := range fileInfos {
+		name := fileInfo.Name()
+		if fileInfo.IsDir() {
+			name = name + "/"
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	buffer := bytes.NewBuffer(nil)
+	fmt.Fprintf(buffer, "<html>\n\t<head><title>%s</title></head>\n\t<body>\n\t\t<h1>%s</h1>\n", html.EscapeString(r.URL.Path), html.EscapeString(r.URL.Path))
+	for _, name := range names {
+		fmt.Fprintf(buffer, "\t\t<p><a href=\"./%s\">%s</a></p>\n", html.EscapeString(name), html.EscapeString(name))
+	}
+	buffer.WriteString("\t</body>\n</html>\n")
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(buffer.Bytes())
+}
+
+func (s *Server) notFound(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s not found\n", r.Method, r.URL.Path)
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	// Use the book's own 404 page if it has one
+	page, err := ioutil.ReadFile(filepath.Join(s.Root, "404.html"))
+	if err != nil {
+		page = []byte(fmt.Sprintf(notFoundPage, html.EscapeString(r.URL.Path)))
+	}
+
+	w.WriteHeader(http.StatusNotFound)
+	w.Write(page)
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func setupRoot(t *testing.T) string {
+	root, err := ioutil.TempDir("", "gutenberg-server")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+
+	os.MkdirAll(filepath.Join(root, "sub"), 0755)
+	os.MkdirAll(filepath.Join(root, "empty"), 0755)
+	ioutil.WriteFile(filepath.Join(root, "ex0.html"), []byte("<html>ex0</html>"), 0644)
+	ioutil.WriteFile(filepath.Join(root, "page.css"), []byte("body {}"), 0644)
+	ioutil.WriteFile(filepath.Join(root, "sub", "index.html"), []byte("<html>index</html>"), 0644)
+	return root
+}
+
+func get(s *Server, url string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest("GET", url, nil))
+	return recorder
+}
+
+/**
+ * Tests
+ **/
+func TestServeFileWithContentType(t *testing.T) {
+	root := setupRoot(t)
+	defer os.RemoveAll(root)
+	s := NewServer(root, "1313")
+
+	response := get(s, "/ex0.html")
+	if response.Code != http.StatusOK {
+		t.Errorf("expected 200 got %d", response.Code)
+	}
+
+	if !strings.HasPrefix(response.Header().Get("Content-Type"), "text/html") {
+		t.Errorf("unexpected content type %s", response.Header().Get("Content-Type"))
+	}
+
+	response = get(s, "/page.css")
+	if !strings.HasPrefix(response.Header().Get("Content-Type"), "text/css") {
+		t.Errorf("unexpected content type %s", response.Header().Get("Content-Type"))
+	}
+}
+
+func TestServeDirectoryIndex(t *testing.T) {
+	root := setupRoot(t)
+	defer os.RemoveAll(root)
+	s := NewServer(root, "1313")
+
+	response := get(s, "/sub")
+	if response.Code != http.StatusMovedPermanently {
+		t.Errorf("expected redirect got %d", response.Code)
+	}
+
+	response = get(s, "/sub/")
+	if response.Body.String() != "<html>index</html>" {
+		t.Errorf("expected index page got [%s]", response.Body.String())
+	}
+
+	response = get(s, "/")
+	if !strings.Contains(response.Body.String(), "ex0.html") {
+		t.Errorf("expected directory listing got [%s]", response.Body.String())
+	}
+}
+
+func TestNotFound(t *testing.T) {
+	root := setupRoot(t)
+	defer os.RemoveAll(root)
+	s := NewServer(root, "1313")
+
+	response := get(s, "/missing.html")
+	if response.Code != http.StatusNotFound {
+		t.Errorf("expected 404 got %d", response.Code)
+	}
+
+	response = get(s, "/../../etc/passwd")
+	if response.Code != http.StatusNotFound {
+		t.Errorf("expected 404 got %d", response.Code)
+	}
+
+	// The book can provide its own 404 page
+	ioutil.WriteFile(filepath.Join(root, "404.html"), []byte("custom"), 0644)
+	response = get(s, "/missing.html")
+	if response.Code != http.StatusNotFound || response.Body.String() != "custom" {
+		t.Errorf("expected custom 404 page got %d [%s]", response.Code, response.Body.String())
+	}
+}
+
+func TestLiveReloadInjection(t *testing.T) {
+	root := setupRoot(t)
+	defer os.RemoveAll(root)
+	ioutil.WriteFile(filepath.Join(root, "ex1.html"), []byte("<html><body>ex1</body></html>"), 0644)
+	s := NewServer(root, "1313")
+
+	// Production builds are served untouched
+	response := get(s, "/ex1.html")
+	if strings.Contains(response.Body.String(), "livereload") {
+		t.Errorf("unexpected live reload client in [%s]", response.Body.String())
+	}
+
+	response = get(s, liveReloadScriptPath)
+	if response.Code != http.StatusNotFound {
+		t.Errorf("expected 404 got %d", response.Code)
+	}
+
+	s.LiveReload = true
+	response = get(s, "/ex1.html")
+	if response.Body.String() != "<html><body>ex1"+string(liveReloadTag)+"</body></html>" {
+		t.Errorf("expected live reload client before </body> got [%s]", response.Body.String())
+	}
+
+	response = get(s, "/ex0.html")
+	if !strings.HasSuffix(response.Body.String(), string(liveReloadTag)) {
+		t.Errorf("expected live reload client at the end got [%s]", response.Body.String())
+	}
+
+	response = get(s, liveReloadScriptPath)
+	if !strings.Contains(response.Body.String(), "EventSource") {
+		t.Errorf("expected live reload client got [%s]", response.Body.String())
+	}
+}
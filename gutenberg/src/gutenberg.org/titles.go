@@ -0,0 +1,41 @@
+package gutenberg
+
+import (
+	"strings"
+)
+
+// Returns the text of the first level one header in the markdown, either
+// "# Title" or a title underlined with "=", or "" if there is none. The label
+// of the header is not part of the title.
+func FirstHeading(markdown []byte) string {
+	lines := strings.Split(strings.Replace(string(markdown), "\r\n", "\n", -1), "\n")
+	inFence := false
+
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+
+		// Skip fenced code blocks
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			inFence = !inFence
+			continue
+		}
+
+		// Skip indented code blocks as well
+		if inFence || trimmed == "" || strings.HasPrefix(line, "    ") || strings.HasPrefix(line, "\t") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "#") && !strings.HasPrefix(line, "##") {
+			return headingLabel.ReplaceAllString(strings.TrimSpace(strings.TrimRight(strings.TrimSpace(line[1:]), "#")), "")
+		}
+
+		if i+1 < len(lines) {
+			underline := strings.TrimSpace(lines[i+1])
+			if len(underline) > 0 && strings.Trim(underline, "=") == "" {
+				return headingLabel.ReplaceAllString(trimmed, "")
+			}
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,26 @@
+package gutenberg
+
+import (
+	"testing"
+)
+
+/**
+ * Tests
+ **/
+func TestFirstHeading(t *testing.T) {
+	tests := map[string]string{
+		"Exercise 5: Document documents everywhere\n=========================================\n\nText": "Exercise 5: Document documents everywhere",
+		"Some text\n\n# Exercise 1: The package manager #\n":                                           "Exercise 1: The package manager",
+		"## Not a chapter\n\nAggregation\n===\n":                                                       "Aggregation",
+		"```js\n# comment\n```\n    # indented\n\nTitle\n=====":                                        "Title",
+		"No headings\n-----------\n":                                                                   "",
+		"# Schema Design {#schema-design}\n":                                                           "Schema Design",
+	}
+
+	for markdown, expected := range tests {
+		title := FirstHeading([]byte(markdown))
+		if title != expected {
+			t.Errorf("expected [%s] got [%s] for [%s]", expected, title, markdown)
+		}
+	}
+}
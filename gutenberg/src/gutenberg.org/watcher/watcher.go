@@ -0,0 +1,249 @@
+package watcher
+
+import (
+	"github.com/howeyc/fsnotify"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Watches a directory tree and reports the files that changed in batches,
+// either driven by file system notifications or by polling
+type Watcher struct {
+	// Batches of changed files
+	Changes chan []string
+	// Root directory we are watching
+	Root string
+	// Paths we never report changes for (e.g. the output directory)
+	Ignore []string
+
+	fs   *fsnotify.Watcher
+	done chan bool
+}
+
+func newWatcher(root string, ignore []string) (*Watcher, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+
+	// Make all the ignored paths absolute so we can compare them
+	ignored := make([]string, 0, len(ignore))
+	for _, path := range ignore {
+		path, err = filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+
+		ignored = append(ignored, path)
+	}
+
+	return &Watcher{Changes: make(chan []string),
+		Root:   root,
+		Ignore: ignored,
+		done:   make(chan bool),
+	}, nil
+}
+
+// Create a watcher driven by file system notifications (inotify on Linux).
+// Changes are reported once no new event has arrived for the debounce delay
+// so that a burst of saves only causes a single batch.
+func NewWatcher(root string, ignore []string, debounce time.Duration) (*Watcher, error) {
+	w, err := newWatcher(root, ignore)
+	if err != nil {
+		return nil, err
+	}
+
+	w.fs, err = fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	// Watch all the existing directories
+	err = w.watchTree(w.Root)
+	if err != nil {
+		w.fs.Close()
+		return nil, err
+	}
+
+	go w.notifyLoop(debounce)
+	return w, nil
+}
+
+// Create a watcher that looks at the modification time of every file
+// in the tree every interval
+func NewPollingWatcher(root string, ignore []string, interval time.Duration) (*Watcher, error) {
+	w, err := newWatcher(root, ignore)
+	if err != nil {
+		return nil, err
+	}
+
+	// Take the first snapshot before returning so no change is missed
+	go w.pollLoop(w.snapshot(), interval)
+	return w, nil
+}
+
+// Stop watching
+func (w *Watcher) Close() error {
+	close(w.done)
+
+	if w.fs != nil {
+		return w.fs.Close()
+	}
+
+	return nil
+}
+
+// Returns true if we should not report changes for a path, this covers the
+// ignored paths as well as hidden files and editor swap and backup files
+func (w *Watcher) IsIgnored(path string) bool {
+	for _, ignored := range w.Ignore {
+		if path == ignored || strings.HasPrefix(path, ignored+string(filepath.Separator)) {
+			return true
+		}
+	}
+
+	name := filepath.Base(path)
+	return strings.HasPrefix(name, ".") ||
+		strings.HasPrefix(name, "#") ||
+		strings.HasSuffix(name, "~") ||
+		strings.HasSuffix(name, ".swp") ||
+		strings.HasSuffix(name, ".swx") ||
+		name == "4913"
+}
+
+func (w *Watcher) watchTree(dir string) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() {
+			return nil
+		}
+
+		if path != w.Root && w.IsIgnored(path) {
+			return filepath.SkipDir
+		}
+
+		return w.fs.Watch(path)
+	})
+}
+
+func (w *Watcher) notifyLoop(debounce time.Duration) {
+	changed := make(map[string]bool)
+	var settled <-chan time.Time
+
+	for {
+		select {
+		case event := <-w.fs.Event:
+			if w.IsIgnored(event.Name) {
+				continue
+			}
+
+			// Pick up directories created after we started
+			if event.IsCreate() {
+				info, err := os.Stat(event.Name)
+				if err == nil && info.IsDir() {
+					err = w.watchTree(event.Name)
+					if err != nil {
+						log.Printf("Failed to watch directory %s: %v\n", event.Name, err)
+					}
+				}
+			}
+
+			// Wait for the file system to settle down again
+			changed[event.Name] = true
+			settled = time.After(debounce)
+		case err := <-w.fs.Error:
+			log.Printf("Watch error: %v\n", err)
+		case <-settled:
+			settled = nil
+			if !w.send(changed) {
+				return
+			}
+
+			changed = make(map[string]bool)
+		case <-w.done:
+			return
+		}
+	}
+}
+
+func (w *Watcher) pollLoop(previous map[string]os.FileInfo, interval time.Duration) {
+	for {
+		select {
+		case <-time.After(interval):
+		case <-w.done:
+			return
+		}
+
+		current := w.snapshot()
+		changed := make(map[string]bool)
+
+		// Modified and created files
+		for path, info := range current {
+			old, ok := previous[path]
+			if !ok || !old.ModTime().Equal(info.ModTime()) || old.Size() != info.Size() {
+				changed[path] = true
+			}
+		}
+
+		// Deleted files
+		for path := range previous {
+			if _, ok := current[path]; !ok {
+				changed[path] = true
+			}
+		}
+
+		previous = current
+		if len(changed) > 0 && !w.send(changed) {
+			return
+		}
+	}
+}
+
+func (w *Watcher) snapshot() map[string]os.FileInfo {
+	files := make(map[string]os.FileInfo)
+
+	filepath.Walk(w.Root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+
+		if path != w.Root && w.IsIgnored(path) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if !info.IsDir() {
+			files[path] = info
+		}
+
+		return nil
+	})
+
+	return files
+}
+
+// Send a sorted batch of changes, returns false if the watcher was closed
+func (w *Watcher) send(changed map[string]bool) bool {
+	paths := make([]string, 0, len(changed))
+	for path := range changed {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	select {
+	case w.Changes <- paths:
+		return true
+	case <-w.done:
+		return false
+	}
+}
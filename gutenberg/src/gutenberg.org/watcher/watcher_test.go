@@ -0,0 +1,87 @@
+package watcher
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func waitForChanges(t *testing.T, w *Watcher) []string {
+	select {
+	case changes := <-w.Changes:
+		return changes
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no changes reported")
+	}
+
+	return nil
+}
+
+/**
+ * Tests
+ **/
+func TestDebounceAndNewDirectories(t *testing.T) {
+	root, err := ioutil.TempDir("", "gutenberg-watcher")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	defer os.RemoveAll(root)
+	root, _ = filepath.EvalSymlinks(root)
+	os.Mkdir(filepath.Join(root, "output"), 0755)
+
+	w, err := NewWatcher(root, []string{filepath.Join(root, "output")}, 200*time.Millisecond)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	defer w.Close()
+
+	// A burst of saves is a single batch
+	page := filepath.Join(root, "ex0.md")
+	for i := 0; i < 5; i++ {
+		ioutil.WriteFile(page, []byte("# Exercise 0"), 0644)
+		ioutil.WriteFile(filepath.Join(root, ".ex0.md.swp"), []byte("swap"), 0644)
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	changes := waitForChanges(t, w)
+	if len(changes) != 1 || changes[0] != page {
+		t.Errorf("expected a single change for %s got %v", page, changes)
+	}
+
+	// Directories created after startup are watched as well
+	os.Mkdir(filepath.Join(root, "code"), 0755)
+	waitForChanges(t, w)
+
+	code := filepath.Join(root, "code", "ex1.js")
+	ioutil.WriteFile(code, []byte("var a = 1;"), 0644)
+	ioutil.WriteFile(filepath.Join(root, "output", "ex1.html"), []byte(""), 0644)
+
+	changes = waitForChanges(t, w)
+	if len(changes) != 1 || changes[0] != code {
+		t.Errorf("expected a single change for %s got %v", code, changes)
+	}
+}
+
+func TestPolling(t *testing.T) {
+	root, err := ioutil.TempDir("", "gutenberg-watcher")
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	defer os.RemoveAll(root)
+
+	w, err := NewPollingWatcher(root, nil, 50*time.Millisecond)
+	if err != nil {
+		t.Fatalf("%q", err)
+	}
+	defer w.Close()
+
+	page := filepath.Join(w.Root, "ex0.md")
+	ioutil.WriteFile(page, []byte("# Exercise 0"), 0644)
+
+	changes := waitForChanges(t, w)
+	if len(changes) != 1 || changes[0] != page {
+		t.Errorf("expected a single change for %s got %v", page, changes)
+	}
+}
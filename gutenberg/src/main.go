@@ -2,29 +2,138 @@ package main
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	flag "github.com/ogier/pflag"
 	gutenberg "gutenberg.org"
+	"gutenberg.org/cache"
 	"gutenberg.org/config"
+	"gutenberg.org/format"
+	"gutenberg.org/highlight"
+	"gutenberg.org/scaffold"
+	"gutenberg.org/search"
+	"gutenberg.org/server"
+	"gutenberg.org/watcher"
 	"io/ioutil"
 	"log"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
+	"sync"
 	"text/template"
 	"time"
 )
 
+// The flags are shared by the commands, every command registers the ones it
+// takes with its own flag set
 var (
-	cfgfile   = flag.String("config", "", "config file (default is path/config.json)")
-	help      = flag.BoolP("help", "h", false, "show this help")
-	source    = flag.StringP("source", "s", "", "filesystem path to read files relative from")
-	watchMode = flag.BoolP("watch", "w", false, "watch filesystem for changes and recreate as needed")
-	server    = flag.BoolP("server", "S", false, "run a (very) simple web server")
-	port      = flag.String("port", "1313", "port to run web server on, default :1313")
-	interval  = flag.Int64P("interval", "i", 1000, "pooling interval for watching")
+	cfgfile    = new(string)
+	help       = new(bool)
+	source     = new(string)
+	watchMode  = new(bool)
+	serveMode  = new(bool)
+	port       = new(string)
+	livereload = new(bool)
+	jobs       = new(int)
+	interval   = new(int64)
+	poll       = new(bool)
+	force      = new(bool)
+	debounce   = new(int64)
+	drafts     = new(bool)
+	title      = new(string)
+	formats    = new(string)
+	dryRun     = new(bool)
 )
 
+// Exit codes
+const (
+	ExitOK = 0
+	// The book failed to build or has problems
+	ExitFailure = 1
+	// The command line could not be understood
+	ExitUsage = 2
+)
+
+type Command struct {
+	Name string
+	// Arguments the command takes besides its flags
+	Arguments string
+	// One line description for the list of commands
+	Short string
+	// Register the flags of the command
+	Flags func(fs *flag.FlagSet)
+	// Run the command with the arguments left after the flags, returns the
+	// exit code
+	Run func(args []string) int
+}
+
+var commands = []*Command{
+	{Name: "build", Short: "generate the book into the output directory", Flags: buildFlags, Run: runBuild},
+	{Name: "watch", Short: "generate the book and regenerate it as files change", Flags: watchFlags, Run: runWatch},
+	{Name: "serve", Short: "generate, watch and serve the book with live reload", Flags: serveFlags, Run: runServe},
+	{Name: "check", Short: "validate the configuration without writing anything", Flags: bookFlags, Run: runCheck},
+	{Name: "clean", Short: "remove the output directory", Flags: bookFlags, Run: runClean},
+	{Name: "new", Arguments: "<directory>", Short: "create a new book", Flags: newFlags, Run: runNew},
+	{Name: "migrate", Short: "rewrite the raw html notes of the pages as admonitions", Flags: migrateFlags, Run: runMigrate},
+}
+
+// Running without a command takes the flags of all the commands, -w and -S
+// pick between building, watching and serving like they always did
+var legacyCommand = &Command{Name: "", Flags: legacyFlags, Run: runLegacy}
+
+// Flags every command that reads the book takes
+func bookFlags(fs *flag.FlagSet) {
+	fs.StringVar(cfgfile, "config", "", "config file (default is path/config.json)")
+	fs.StringVarP(source, "source", "s", "", "filesystem path to read files relative from")
+}
+
+func buildFlags(fs *flag.FlagSet) {
+	bookFlags(fs)
+	fs.IntVarP(jobs, "jobs", "j", runtime.NumCPU(), "number of pages to render in parallel")
+	fs.BoolVarP(force, "force", "f", false, "regenerate all pages even if their inputs did not change")
+	fs.BoolVarP(drafts, "drafts", "D", false, "include pages marked as drafts in their front matter")
+	fs.StringVar(formats, "format", "", "comma separated output formats to build, e.g. html,epub (default is default_output_format of the config)")
+}
+
+func watchFlags(fs *flag.FlagSet) {
+	buildFlags(fs)
+	fs.Int64VarP(interval, "interval", "i", 1000, "polling interval for watching in milliseconds")
+	fs.BoolVar(poll, "poll", false, "poll the filesystem for changes instead of using notifications")
+	fs.Int64Var(debounce, "debounce", 100, "milliseconds to wait for changes to settle before regenerating")
+}
+
+func serverFlags(fs *flag.FlagSet) {
+	fs.StringVar(port, "port", "1313", "port to run web server on, default :1313")
+	fs.BoolVar(livereload, "livereload", true, "reload the browser when pages change while watching and serving")
+}
+
+func serveFlags(fs *flag.FlagSet) {
+	watchFlags(fs)
+	serverFlags(fs)
+	fs.BoolVarP(watchMode, "watch", "w", true, "watch filesystem for changes and recreate as needed")
+}
+
+func newFlags(fs *flag.FlagSet) {
+	fs.StringVarP(title, "title", "t", "", "title of the book (default is the name of the directory)")
+}
+
+func migrateFlags(fs *flag.FlagSet) {
+	bookFlags(fs)
+	fs.BoolVarP(dryRun, "dry-run", "n", false, "list the notes that would be rewritten without changing the pages")
+}
+
+func legacyFlags(fs *flag.FlagSet) {
+	watchFlags(fs)
+	serverFlags(fs)
+	fs.BoolVarP(watchMode, "watch", "w", false, "watch filesystem for changes and recreate as needed")
+	fs.BoolVarP(serveMode, "server", "S", false, "run a (very) simple web server")
+}
+
 type Process struct {
 	// Process is done
 	Done chan bool
@@ -33,370 +142,1330 @@ type Process struct {
 	// Started
 	Started bool
 
-	// Contains the statistics for all the pages
-	ConfigFileInfo     *os.FileInfo
-	PageLayoutFileInfo *os.FileInfo
-	IndexFileInfo      *os.FileInfo
-	PagesFileInfo      map[string]*os.FileInfo
-	AssetsFileInfo     map[string]*os.FileInfo
+	// What every page was generated from
+	Manifest *cache.Manifest
+	// Hash of the book wide template context of the last build
+	ContextKey string
+	// The table of contents of the last build
+	Contents []ContentsEntry
+	// The output format being generated
+	Format *format.Format
+	// The search index of the pages
+	Search *search.Index
+	// The labels references in the pages point to
+	Labels *gutenberg.Labels
+	// The files every packaged format was last generated from by the name of
+	// the format, relative to the source directory
+	PackageInputs map[string]map[string]bool
+
+	// Preview server to tell about rewritten files
+	Server *server.Server
+	// Files written to the output directory since the last reload
+	written []string
+	// Protects the state pages update while they render in parallel
+	lock sync.Mutex
+}
+
+// Record a file written to the output directory
+func (p *Process) Wrote(file string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.written = append(p.written, file)
+}
+
+// Tell the preview server about all the files written since the last reload
+func (p *Process) Reload() {
+	p.lock.Lock()
+	written := p.written
+	p.written = nil
+	p.lock.Unlock()
+
+	if p.Server != nil {
+		p.Server.Reload(written)
+	}
+}
+
+func usage(command *Command, fs *flag.FlagSet) {
+	if command == legacyCommand {
+		PrintErr("usage: gutenberg <command> [flags]\n\ncommands:")
+		for _, c := range commands {
+			PrintErr("  %-8s%s", c.Name, c.Short)
+		}
+		PrintErr("\nwithout a command -w watches and -S serves the book, flags:")
+	} else {
+		PrintErr("usage: gutenberg %s [flags] %s\n\n%s, flags:", command.Name, command.Arguments, command.Short)
+	}
+
+	fs.PrintDefaults()
+}
+
+func main() {
+	args := os.Args[1:]
+
+	// Pick the command, anything else is left to the flags of old
+	command := legacyCommand
+	if len(args) > 0 {
+		for _, c := range commands {
+			if c.Name == args[0] {
+				command = c
+				args = args[1:]
+				break
+			}
+		}
+	}
+
+	os.Exit(RunCommand(command, args))
+}
+
+// Parse the flags of a command and run it, returns the exit code
+func RunCommand(command *Command, args []string) int {
+	// Flags that cannot be parsed print the usage and exit with ExitUsage
+	fs := flag.NewFlagSet(strings.TrimSpace("gutenberg "+command.Name), flag.ExitOnError)
+	fs.BoolVarP(help, "help", "h", false, "show this help")
+	command.Flags(fs)
+	fs.Usage = func() {
+		usage(command, fs)
+	}
+
+	err := fs.Parse(args)
+	if err != nil {
+		return ExitUsage
+	}
+
+	if *help {
+		fs.Usage()
+		return ExitOK
+	}
+
+	return command.Run(fs.Args())
+}
+
+// Report arguments a command does not take
+func noArguments(args []string) bool {
+	if len(args) > 0 {
+		PrintErr("Error:: unknown command or argument %s, see gutenberg --help", args[0])
+		return false
+	}
+
+	return true
+}
+
+func runLegacy(args []string) int {
+	if !noArguments(args) {
+		return ExitUsage
+	}
+
+	if *serveMode {
+		return runServe(args)
+	}
+
+	if *watchMode {
+		return runWatch(args)
+	}
+
+	return runBuild(args)
+}
+
+// Read the configuration and generate the whole book once
+func Build() (*Process, *config.Config, error) {
+	// Read the configuration
+	c, err := config.ReadConfigFromFile(cfgfile, source)
+	if err != nil {
+		PrintErr("Error:: %v", err)
+		return nil, nil, err
+	}
+
+	// Create a Process
+	process := &Process{Done: make(chan bool, 1),
+		Source:  config.SourcePath(source),
+		Started: true,
+	}
+
+	// Create output directory if it does not exist
+	err = os.Mkdir(c.OutputDirectory, 0755)
+
+	// Generate whole book
+	return process, c, GenerateWholeBook(process)
+}
+
+func runBuild(args []string) int {
+	if !noArguments(args) {
+		return ExitUsage
+	}
+
+	_, _, err := Build()
+	if err != nil {
+		return ExitFailure
+	}
+
+	return ExitOK
+}
+
+func runWatch(args []string) int {
+	if !noArguments(args) {
+		return ExitUsage
+	}
+
+	// Keep watching a book that fails to build so it can be fixed
+	process, _, err := Build()
+	if process == nil {
+		return ExitFailure
+	}
+
+	err = WatchMode(process)
+	if err != nil {
+		PrintErr("Error:: %v", err)
+		return ExitFailure
+	}
+
+	return ExitOK
+}
+
+func runServe(args []string) int {
+	if !noArguments(args) {
+		return ExitUsage
+	}
+
+	process, c, err := Build()
+	if process == nil || (err != nil && !*watchMode) {
+		return ExitFailure
+	}
+
+	// Serve the output directory
+	process.Server = server.NewServer(c.OutputDirectory, *port)
+	process.Server.LiveReload = *watchMode && *livereload
+
+	// Go into watch mode
+	if *watchMode {
+		go func() {
+			err := WatchMode(process)
+			if err != nil {
+				log.Printf("Stopped watching: %v\n", err)
+			}
+		}()
+	}
+
+	// Wait until the server is shut down
+	err = ServeMode(process.Server, process)
+	if err != nil {
+		return ExitFailure
+	}
+
+	return ExitOK
+}
+
+func runCheck(args []string) int {
+	if !noArguments(args) {
+		return ExitUsage
+	}
+
+	return Check()
+}
+
+// Remove the output directory, the manifest goes with it so the next build
+// generates every page
+func runClean(args []string) int {
+	if !noArguments(args) {
+		return ExitUsage
+	}
+
+	c, err := config.ReadConfigFromFile(cfgfile, source)
+	if err != nil {
+		PrintErr("Error:: %v", err)
+		return ExitFailure
+	}
+
+	// Never remove the book itself
+	output, _ := filepath.Abs(c.OutputDirectory)
+	book, _ := filepath.Abs(config.SourcePath(source))
+	if c.OutputDirectory == "" || output == book || strings.HasPrefix(book, output+string(filepath.Separator)) {
+		PrintErr("Error:: refusing to remove %s as it holds the book", output)
+		return ExitFailure
+	}
+
+	log.Printf("Removing %s\n", c.OutputDirectory)
+	err = os.RemoveAll(c.OutputDirectory)
+	if err != nil {
+		PrintErr("Error:: %v", err)
+		return ExitFailure
+	}
+
+	return ExitOK
+}
+
+// Write the skeleton of a new book that builds as is
+func runNew(args []string) int {
+	if len(args) != 1 {
+		PrintErr("Error:: gutenberg new takes the directory of the book, see gutenberg new --help")
+		return ExitUsage
+	}
+
+	files, err := scaffold.Create(args[0], *title)
+	if err != nil {
+		PrintErr("Error:: %v", err)
+		return ExitFailure
+	}
+
+	for _, file := range files {
+		log.Printf("Created %s\n", filepath.Join(args[0], file))
+	}
+
+	fmt.Printf("Your new book is in %s, build it with\n\n  cd %s && gutenberg build\n", args[0], args[0])
+	return ExitOK
+}
+
+// Rewrite the <div class="note"> blocks the pages of the book write by hand
+// as admonitions
+func runMigrate(args []string) int {
+	if !noArguments(args) {
+		return ExitUsage
+	}
+
+	c, err := config.ReadConfigFromFile(cfgfile, source)
+	if err != nil {
+		PrintErr("Error:: %v", err)
+		return ExitFailure
+	}
+
+	sourcePath := config.SourcePath(source)
+	total := 0
+	for _, page := range c.TableOfContents {
+		fileName := fmt.Sprintf("%s/%s", sourcePath, page.File)
+		data, err := ioutil.ReadFile(fileName)
+		if err != nil {
+			PrintErr("Error:: %v", err)
+			return ExitFailure
+		}
+
+		data, count := gutenberg.MigrateNotes(data)
+		if count == 0 {
+			continue
+		}
+
+		total += count
+		log.Printf("Found %d notes in %s\n", count, page.File)
+		if *dryRun {
+			continue
+		}
+
+		err = ioutil.WriteFile(fileName, data, 0644)
+		if err != nil {
+			PrintErr("Error:: %v", err)
+			return ExitFailure
+		}
+	}
+
+	if *dryRun {
+		fmt.Printf("%d notes would be rewritten\n", total)
+	} else {
+		fmt.Printf("%d notes rewritten\n", total)
+	}
+	return ExitOK
+}
+
+// Serve until interrupted, the watcher is told to stop once the server is down
+func ServeMode(s *server.Server, p *Process) error {
+	// Shut down cleanly on SIGINT
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	go func() {
+		<-signals
+		log.Printf("Shutting down web server\n")
+		err := s.Shutdown()
+		if err != nil {
+			log.Printf("Failed to shut down web server: %v\n", err)
+		}
+	}()
+
+	log.Printf("Serving %s on http://localhost:%s/\n", s.Root, s.Port)
+	err := s.ListenAndServe()
+	if err != nil {
+		log.Printf("Web server failed: %v\n", err)
+	}
+
+	// We are done
+	p.Done <- true
+	return err
+}
+
+func WatchMode(p *Process) error {
+	// Read the configuration so we know what to leave alone
+	c, err := config.ReadConfigFromFile(cfgfile, source)
+	if err != nil {
+		return err
+	}
+
+	// Never react to our own output
+	ignore := []string{c.OutputDirectory}
+
+	// Set up the watcher, falling back to polling if notifications are not available
+	var w *watcher.Watcher
+	if !*poll {
+		w, err = watcher.NewWatcher(p.Source, ignore, time.Duration(*debounce)*time.Millisecond)
+		if err != nil {
+			log.Printf("File system notifications not available (%v), polling instead\n", err)
+		}
+	}
+
+	if w == nil {
+		w, err = watcher.NewPollingWatcher(p.Source, ignore, time.Duration(*interval)*time.Millisecond)
+		if err != nil {
+			return fmt.Errorf("failed to watch %s: %v", p.Source, err)
+		}
+	}
+	defer w.Close()
+
+	log.Printf("Watching %s for changes\n", p.Source)
+
+	for {
+		select {
+		case changes := <-w.Changes:
+			RegenerateChanges(p, w.Root, changes)
+		case <-p.Done:
+			// We are done
+			return nil
+		}
+	}
+}
+
+func RegenerateChanges(p *Process, root string, changes []string) {
+	// Get the parts of the config file
+	sourcePath := config.SourcePath(source)
+	configFile := config.ConfigFile(sourcePath, cfgfile)
+
+	// Read the configuration
+	c, err := config.ReadConfigFromFile(cfgfile, source)
+	if err != nil {
+		log.Printf("Failed to read configuration file from %s\n", configFile)
+		return
+	}
+
+	// Set the source path
+	c.SourcePath = sourcePath
+
+	// The formats to regenerate
+	selected, err := Formats(c)
+	if err != nil {
+		log.Printf("%v\n", err)
+		return
+	}
+
+	// Formats with a page per file can be regenerated page by page, the
+	// packaged ones are generated again as a whole
+	pageFormats := make([]*format.Format, 0)
+	packagedFormats := make([]*format.Format, 0)
+	for _, f := range selected {
+		if f.Package == nil {
+			pageFormats = append(pageFormats, f)
+		} else {
+			packagedFormats = append(packagedFormats, f)
+		}
+	}
+
+	// The manifest only keeps track of the pages of one format
+	if len(pageFormats) > 1 {
+		GenerateWholeBook(p)
+		return
+	}
+
+	// Let the browsers know once we are done
+	defer p.Reload()
+
+	// Index the changed files by their path relative to the source
+	changed := make(map[string]bool)
+	for _, change := range changes {
+		relative, err := filepath.Rel(root, change)
+		if err == nil {
+			changed[filepath.ToSlash(relative)] = true
+		}
+	}
+
+	configFileName, _ := filepath.Rel(sourcePath, configFile)
+
+	// If the configuration or a layout changed everything needs regenerating
+	layouts := []string{configFileName}
+	for _, layout := range c.Layouts {
+		layouts = append(layouts, layout.Index, layout.Page)
+	}
+	for _, index := range c.Indexes {
+		if index.HTML.Layout != "" {
+			layouts = append(layouts, index.HTML.Layout)
+		}
+	}
+
+	for _, file := range layouts {
+		if file != "" && changed[filepath.ToSlash(filepath.Clean(file))] {
+			log.Printf("%s changed, regenerating whole book\n", file)
+			GenerateWholeBook(p)
+			return
+		}
+	}
+
+	// Chapter titles are on every page so they all need regenerating
+	p.Format = selected[0]
+	BuildTableOfContents(p, c)
+	if ContextKey(p, c) != p.ContextKey {
+		log.Printf("Chapter titles changed, regenerating whole book\n")
+		GenerateWholeBook(p)
+		return
+	}
+
+	for _, f := range pageFormats {
+		p.Format = f
+		RegeneratePages(p, c, changed)
+	}
+
+	for _, f := range packagedFormats {
+		p.Format = f
+		if !PackageChanged(p, f, changed) {
+			continue
+		}
+
+		err = GeneratePackage(p, c)
+		if err != nil {
+			log.Printf("Failed to generate %s: %v\n", f.Name, err)
+		}
+	}
+}
+
+// Copy the changed assets and regenerate the pages that changed or include
+// the changed files
+func RegeneratePages(p *Process, c *config.Config, changed map[string]bool) {
+	// Copy over the assets that changed
+	for _, asset := range c.Assets {
+		if changed[filepath.ToSlash(filepath.Clean(asset))] {
+			err := CopyAsset(p, c, asset)
+			if err != nil {
+				log.Printf("Failed to copy asset %s: %v\n", asset, err)
+			}
+		}
+	}
+
+	// Find the pages that include the changed files
+	BuildTableOfContents(p, c)
+	for _, err := range p.Labels.Errors() {
+		log.Printf("%v\n", err)
+	}
+
+	p.Manifest = cache.LoadManifest(c.OutputDirectory, p.Source)
+	dependents := make(map[string]bool)
+	for file := range changed {
+		for _, page := range p.Manifest.Dependents(file) {
+			if page != file {
+				log.Printf("%s changed, regenerating %s\n", file, page)
+			}
+
+			dependents[page] = true
+		}
+	}
+
+	// We only re-generate pages that have changed
+	pages := make([]config.TableOfContentsEntry, 0)
+	for _, page := range c.TableOfContents {
+		if changed[filepath.ToSlash(filepath.Clean(page.File))] || dependents[page.File] {
+			pages = append(pages, page)
+		}
+	}
+
+	if len(pages) > 0 {
+		p.Search = search.LoadIndex(c.OutputDirectory)
+		err := GeneratePages(p, c, ReadPageTemplate(p, c), pages)
+		if err != nil {
+			log.Printf("Failed to generate pages: %v\n", err)
+		}
+
+		err = WriteSearchIndex(p, c)
+		if err != nil {
+			log.Printf("Failed to save the search index: %v\n", err)
+		}
+	}
+}
+
+type Page struct {
+	Page string
+}
+
+// An entry of the table of contents as the templates see it
+type ContentsEntry struct {
+	// The markdown file the page is generated from
+	Source string
+	// The file the page is written to
+	File        string
+	Title       string
+	Description string
+	Tags        []string
+	Number      int
+	// Set for the page being rendered
+	Active bool
+}
+
+// Build the template context for a page, current is the position of the page
+// in the table of contents or -1 for pages that are not part of it
+func BuildContext(html string, c *config.Config, contents []ContentsEntry, current int, frontMatter *gutenberg.FrontMatter) map[string]interface{} {
+	// var result map[string]interface{}
+	result := make(map[string]interface{})
+	result["Page"] = html
+	result["FrontMatter"] = frontMatter
+	result["Book"] = c.Book
+	result["BuildDate"] = time.Now()
+	// Let's add all the indexes available
+	for name, c := range c.Indexes {
+		uppedName := strings.ToUpper((string)([]byte(name)[0:1])) + string([]byte(name)[1:])
+		// Add the result
+		result[uppedName] = c
+	}
+
+	// The table of contents with the current page marked
+	tableOfContents := make([]ContentsEntry, len(contents))
+	copy(tableOfContents, contents)
+	result["TableOfContents"] = tableOfContents
+
+	// The current, previous and next pages
+	result["Current"] = nil
+	result["Previous"] = nil
+	result["Next"] = nil
+	if current >= 0 && current < len(tableOfContents) {
+		tableOfContents[current].Active = true
+		result["Current"] = tableOfContents[current]
+
+		if current > 0 {
+			result["Previous"] = tableOfContents[current-1]
+		}
+
+		if current+1 < len(tableOfContents) {
+			result["Next"] = tableOfContents[current+1]
+		}
+	}
+
+	return result
+}
+
+// Returns the name of the file a page is rendered to in the format being
+// generated, e.g. ex0.html for ex0.md
+func (p *Process) PageOutputName(page config.TableOfContentsEntry) string {
+	return p.Format.PageFile(page)
+}
+
+// Returns the html files of the pages of the book the links in the markdown
+// point to
+func LinkTargets(c *config.Config) []string {
+	targets := make([]string, 0, len(c.TableOfContents))
+	for _, page := range c.TableOfContents {
+		targets = append(targets, page.OutputName())
+	}
+
+	return targets
+}
+
+// Build the table of contents the templates see, every chapter is titled by
+// its entry, its front matter or else by the first header in the page. Pages
+// marked as drafts are left out of the book unless drafts are asked for. The
+// chapters index is built from it unless the configuration lists its entries.
+func BuildTableOfContents(p *Process, c *config.Config) {
+	p.Contents = make([]ContentsEntry, 0, len(c.TableOfContents))
+	pages := make([]config.TableOfContentsEntry, 0, len(c.TableOfContents))
+
+	for _, page := range c.TableOfContents {
+		frontMatter := &gutenberg.FrontMatter{}
+		body := []byte{}
+
+		data, err := ioutil.ReadFile(fmt.Sprintf("%s/%s", p.Source, page.File))
+		if err == nil {
+			frontMatter, body, err = gutenberg.ParseFrontMatter(data)
+			if err != nil {
+				// Rendering the page reports the error
+				frontMatter, body = &gutenberg.FrontMatter{}, data
+			}
+		}
+
+		if frontMatter.Draft && !*drafts {
+			log.Printf("Skipping draft %s\n", page.File)
+			continue
+		}
+
+		title := page.Title
+		if title == "" {
+			title = frontMatter.Title
+		}
+
+		if title == "" {
+			title = gutenberg.FirstHeading(body)
+		}
+
+		if title == "" {
+			title = page.File
+		}
+
+		pages = append(pages, page)
+		p.Contents = append(p.Contents, ContentsEntry{Source: page.File,
+			File:        p.PageOutputName(page),
+			Title:       title,
+			Description: frontMatter.Description,
+			Tags:        frontMatter.Tags,
+			Number:      c.FirstChapter + len(p.Contents),
+		})
+	}
+
+	// Only the pages in the book get generated
+	c.TableOfContents = pages
+	p.Labels = CollectBookLabels(p.Source, c)
+
+	chapters := c.Indexes["chapters"]
+
+	// Entries listed in the configuration win
+	if len(chapters.HTML.Entries) > 0 {
+		return
+	}
+
+	for _, entry := range p.Contents {
+		chapters.HTML.Entries = append(chapters.HTML.Entries, config.IndexEntry{File: entry.File, Title: entry.Title})
+	}
+
+	if c.Indexes == nil {
+		c.Indexes = make(map[string]config.Index)
+	}
+	c.Indexes["chapters"] = chapters
+}
+
+// Collect the labels of the pages in the order of the table of contents,
+// drafts are left out unless drafts are asked for so the chapters keep the
+// numbers they have in the book
+func CollectBookLabels(sourcePath string, c *config.Config) *gutenberg.Labels {
+	pages := make([]gutenberg.LabelPage, 0, len(c.TableOfContents))
+	for _, page := range c.TableOfContents {
+		data, err := ioutil.ReadFile(fmt.Sprintf("%s/%s", sourcePath, page.File))
+		if err != nil {
+			continue
+		}
+
+		frontMatter, body, err := gutenberg.ParseFrontMatter(data)
+		if err != nil {
+			frontMatter, body = &gutenberg.FrontMatter{}, data
+		}
+
+		if frontMatter.Draft && !*drafts {
+			continue
+		}
+
+		pages = append(pages, gutenberg.LabelPage{Source: page.File,
+			File:     page.OutputName(),
+			Number:   c.FirstChapter + len(pages),
+			Markdown: body,
+		})
+	}
+
+	return gutenberg.CollectLabels(pages)
+}
+
+// Returns the position of a page in the table of contents or -1
+func (p *Process) ContentsPosition(page config.TableOfContentsEntry) int {
+	for i, entry := range p.Contents {
+		if entry.Source == page.File {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Returns a hash of everything besides the page itself that ends up in
+// every page, e.g. the chapter titles and the labels references point to
+func ContextKey(p *Process, c *config.Config) string {
+	data, _ := json.Marshal([]interface{}{c.Book, c.Indexes, p.Contents, p.Labels.All()})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
 }
 
-func usage() {
-	PrintErr("usage: gutenberg [flags]", "")
-	flag.PrintDefaults()
-	os.Exit(0)
+// Validate the configuration and the front matter of the pages, returns the
+// exit code
+func Check() int {
+	sourcePath := config.SourcePath(source)
+	configFile := config.ConfigFile(sourcePath, cfgfile)
+
+	c, err := config.ReadConfigFromFile(cfgfile, source)
+	if err != nil {
+		PrintErr("Error:: %v", err)
+		return ExitFailure
+	}
+
+	problems := CheckBook(sourcePath, c)
+	for _, problem := range problems {
+		PrintErr("Error:: %v", problem)
+	}
+
+	if len(problems) > 0 {
+		return ExitFailure
+	}
+
+	fmt.Printf("%s is valid\n", configFile)
+	return ExitOK
 }
 
-func main() {
-	flag.Usage = usage
-	flag.Parse()
+// Returns every problem with the files the configuration and the front
+// matter of the pages refer to, the labels used twice and the references to
+// labels that do not exist
+func CheckBook(sourcePath string, c *config.Config) []error {
+	problems := config.Validate(c, sourcePath)
 
-	if *help {
-		usage()
+	for _, page := range c.TableOfContents {
+		data, err := ioutil.ReadFile(fmt.Sprintf("%s/%s", sourcePath, page.File))
+		if err != nil {
+			// Already reported as missing
+			continue
+		}
+
+		frontMatter, _, err := gutenberg.ParseFrontMatter(data)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("%s: %v", page.File, err))
+			continue
+		}
+
+		if frontMatter.Layout != "" {
+			if _, err := os.Stat(fmt.Sprintf("%s/%s", sourcePath, frontMatter.Layout)); err != nil {
+				problems = append(problems, fmt.Errorf("%s: layout %s does not exist", page.File, frontMatter.Layout))
+			}
+		}
 	}
 
-	// Read the configuration
-	c, err := config.ReadConfigFromFile(cfgfile, source)
+	problems = append(problems, CollectBookLabels(sourcePath, c).Errors()...)
+	return problems
+}
+
+func GenerateBook(p *Process, c *config.Config) error {
+	// Build the table of contents and the chapters index from the pages
+	BuildTableOfContents(p, c)
+	p.ContextKey = ContextKey(p, c)
+
+	// Read the page layout
+	pageTemplate := ReadPageTemplate(p, c)
+
+	// Copy over all the assets
+	for _, asset := range c.Assets {
+		err := CopyAsset(p, c, asset)
+		if err != nil {
+			return fmt.Errorf("could not copy the asset %s: %v", asset, err)
+		}
+	}
+
+	// Write the stylesheet for the highlighted code
+	err := WriteHighlightStylesheet(p, c)
 	if err != nil {
-		fmt.Printf("Error:: %v\n", err)
-		os.Exit(0)
+		return err
 	}
 
-	// Create a Process
-	process := &Process{Done: make(chan bool),
-		Source:         *source,
-		Started:        true,
-		PagesFileInfo:  make(map[string]*os.FileInfo),
-		AssetsFileInfo: make(map[string]*os.FileInfo),
+	// Render the landing page
+	err = GenerateIndex(p, c)
+	if err != nil {
+		return err
 	}
 
-	// Create output directory if it does not exist
-	err = os.Mkdir(c.OutputDirectory, 0755)
+	// Render the standalone index pages
+	err = GenerateIndexes(p, c)
+	if err != nil {
+		return err
+	}
 
-	// Generate whole book
-	GenerateWholeBook(process)
+	// Render all the pages
+	p.Manifest = cache.LoadManifest(c.OutputDirectory, p.Source)
+	p.Search = search.LoadIndex(c.OutputDirectory)
+	err = GeneratePages(p, c, pageTemplate, c.TableOfContents)
+	if err != nil {
+		return err
+	}
 
-	// Go into watch mode
-	if *watchMode {
-		WatchMode(*interval, process)
+	return WriteSearchIndex(p, c)
+}
+
+// Write the search index with the documents of the pages of the book and the
+// script that searches it
+func WriteSearchIndex(p *Process, c *config.Config) error {
+	sources := make([]string, 0, len(c.TableOfContents))
+	for _, page := range c.TableOfContents {
+		sources = append(sources, page.File)
+	}
+	p.Search.Keep(sources)
+
+	log.Printf("Saving search index to %s/%s\n", c.OutputDirectory, search.IndexFile)
+	err := p.Search.Write(c.OutputDirectory)
+	if err != nil {
+		return err
+	}
+
+	// The index changes with every edit of a page, the open pages are not
+	// reloaded for it so only the changed page is
+	changed, err := search.WriteClient(c.OutputDirectory)
+	if err != nil {
+		return err
+	}
+
+	if changed {
+		p.Wrote(search.ClientFile)
 	}
+	return nil
 }
 
-func WatchMode(delay int64, p *Process) {
-	go func() {
-		for true {
-			// Get the parts of the config file
-			sourcePath := config.SourcePath(source)
-			configFileLocation := config.ConfigFile(sourcePath, cfgfile)
+func ReadPageTemplate(p *Process, c *config.Config) *template.Template {
+	return ReadTemplate(p, "pageTemplate", p.Format.Layout(c).Page)
+}
 
-			// Set the config file name
-			configFileInfo, err := os.Stat(configFileLocation)
-			if err != nil {
-				log.Printf("Failed to read configuration file from %s\n", configFileLocation)
-				continue
-			}
+func ReadTemplate(p *Process, name string, layout string) *template.Template {
+	// Get the right location for the layout file
+	layoutFile := fmt.Sprintf("%s/%s", p.Source, layout)
 
-			// Read the configuration
-			c, err := config.ReadConfigFromFile(cfgfile, source)
-			if err != nil {
-				log.Printf("Failed to read configuration file from %s\n", configFileLocation)
-				continue
-			}
+	// Read the layout file in
+	layoutBytes, err := ioutil.ReadFile(layoutFile)
+	if err != nil {
+		log.Printf("no layout file found for %s\n", layoutFile)
+	}
 
-			// Point to the actual instance
-			configFileInfoInstance := *p.ConfigFileInfo
-
-			// If config time finished
-			if !configFileInfo.ModTime().Equal(configFileInfoInstance.ModTime()) {
-				log.Printf("Configuration file changed, regenerating whole book\n")
-				// Re-generate the whole book
-				GenerateWholeBook(p)
-				// Save the new configuration file info
-				p.ConfigFileInfo = &configFileInfo
-				// Done, let's watch again
-				continue
-			}
+	// Parse the template into an object
+	layoutTemplate, err := template.New(name).Parse(string(layoutBytes))
+	if err != nil {
+		log.Printf("invalid template found in %s template file\n", layoutFile)
+		return nil
+	}
 
-			// Read all the layouts for html
-			htmlLayouts := c.Layouts["html"]
-			indexLayout := htmlLayouts.Index
-			pageLayout := htmlLayouts.Page
+	return layoutTemplate
+}
 
-			// Get the file info for the pageLayout file
-			pageLayoutFile := fmt.Sprintf("%s/%s", p.Source, pageLayout)
-			pageLayoutFileInfo, err := os.Stat(pageLayoutFile)
-			if err != nil {
-				log.Printf("Index layout file changed, regenerating whole book\n")
-				// Re-generate the whole book
-				GenerateWholeBook(p)
-				// Update the time
-				p.PageLayoutFileInfo = &pageLayoutFileInfo
-				continue
-			}
+// Render the index layout into the landing page of the book
+func GenerateIndex(p *Process, c *config.Config) error {
+	indexLayout := p.Format.Layout(c).Index
+	if indexLayout == "" {
+		return nil
+	}
 
-			// Get the file info for the pageLayout file
-			indexLayoutFile := fmt.Sprintf("%s/%s", p.Source, indexLayout)
-			indexLayoutFileInfo, err := os.Stat(indexLayoutFile)
-			if err != nil {
-				log.Printf("Index layout file changed, regenerating whole book\n")
-				// Re-generate the whole book
-				GenerateWholeBook(p)
-				// Update the time
-				p.IndexFileInfo = &indexLayoutFileInfo
-				continue
-			}
+	indexTemplate := ReadTemplate(p, "indexTemplate", indexLayout)
+	if indexTemplate == nil {
+		return fmt.Errorf("invalid index layout %s", indexLayout)
+	}
 
-			// Read the page layout file in
-			layoutBytes, err := ioutil.ReadFile(pageLayoutFile)
-			if err != nil {
-				log.Printf("no layout file found for %s\n", pageLayoutFile)
-			}
+	log.Printf("Generate index page\n")
 
-			// Parse the template into an object
-			pageTemplate, err := template.New("pageTemplate").Parse(string(layoutBytes))
-			if err != nil {
-				log.Printf("invalid template found in %s page template file\n", pageLayoutFile)
-			}
+	// The index gets the same context as the pages, just without a page
+	buffer := bytes.NewBuffer(nil)
+	err := indexTemplate.Execute(buffer, BuildContext("", c, p.Contents, -1, &gutenberg.FrontMatter{}))
+	if err != nil {
+		return fmt.Errorf("failed to execute template %s: %v", indexLayout, err)
+	}
+
+	output := "index" + p.Format.Extension
+	err = ioutil.WriteFile(fmt.Sprintf("%s/%s", c.OutputDirectory, output), buffer.Bytes(), 0755)
+	if err != nil {
+		return err
+	}
+
+	p.Wrote(output)
+	return nil
+}
 
-			// Copy over all the assets
-			for _, asset := range c.Assets {
-				assetLocation := fmt.Sprintf("%s/%s", p.Source, asset)
-				fileContent, err := ioutil.ReadFile(assetLocation)
+// Render every index that has a layout into its own page
+func GenerateIndexes(p *Process, c *config.Config) error {
+	// Render the indexes in a stable order
+	names := make([]string, 0, len(c.Indexes))
+	for name := range c.Indexes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
 
-				// Get the file info for the pageLayout file
-				assetFileInfo, err := os.Stat(assetLocation)
-				if err == nil {
-					modTime := *p.AssetsFileInfo[asset]
+	for _, name := range names {
+		index := c.Indexes[name].HTML
+		if index.Layout == "" {
+			continue
+		}
 
-					if modTime != nil && modTime.ModTime().Equal(assetFileInfo.ModTime()) {
-						continue
-					}
+		indexTemplate := ReadTemplate(p, name+"Template", index.Layout)
+		if indexTemplate == nil {
+			return fmt.Errorf("invalid layout %s for index %s", index.Layout, name)
+		}
 
-					p.AssetsFileInfo[asset] = &assetFileInfo
-				}
+		output := index.Output
+		if output == "" {
+			output = name + p.Format.Extension
+		}
 
-				if err == nil {
-					assetOutputLocation := fmt.Sprintf("%s/%s", c.OutputDirectory, filepath.Base(asset))
-					log.Printf("Saving asset to %s\n", assetOutputLocation)
+		log.Printf("Generate index %s\n", name)
 
-					err = ioutil.WriteFile(assetOutputLocation, fileContent, 0755)
-					if err != nil {
-						log.Fatalf("Failed to save the asset %s to %s\n", asset, assetOutputLocation)
-					}
-				} else {
-					log.Fatalf("Could not locate the asset %s\n", asset)
-				}
-			}
+		// The index gets the same context as the pages plus its own entries
+		context := BuildContext("", c, p.Contents, -1, &gutenberg.FrontMatter{})
+		context["Name"] = name
+		context["Index"] = index
 
-			// We only re-generate pages that have changed
-			// Read all the pages in
-			for _, page := range c.TableOfContents {
-				// Split the file up so we can get the "name"
-				fileNameParts := strings.Split(page.File, ".")
-				fileName := strings.Join(fileNameParts[0:(len(fileNameParts)-1)], ".")
+		buffer := bytes.NewBuffer(nil)
+		err := indexTemplate.Execute(buffer, context)
+		if err != nil {
+			return fmt.Errorf("failed to execute template %s: %v", index.Layout, err)
+		}
+
+		err = ioutil.WriteFile(fmt.Sprintf("%s/%s", c.OutputDirectory, output), buffer.Bytes(), 0755)
+		if err != nil {
+			return err
+		}
 
-				// Read the page
-				pageFile := fmt.Sprintf("%s/%s", p.Source, page.File)
+		p.Wrote(output)
+	}
 
-				// Get the file info for the pageLayout file
-				pageFileInfo, err := os.Stat(pageFile)
-				if err == nil {
-					modTime := *p.PagesFileInfo[page.File]
+	return nil
+}
 
-					if modTime != nil && modTime.ModTime().Equal(pageFileInfo.ModTime()) {
-						continue
-					}
+func CopyAsset(p *Process, c *config.Config, asset string) error {
+	assetLocation := fmt.Sprintf("%s/%s", p.Source, asset)
+	fileContent, err := ioutil.ReadFile(assetLocation)
+	if err != nil {
+		return err
+	}
 
-					log.Printf("Generate page %s\n", page.File)
-					p.PagesFileInfo[page.File] = &pageFileInfo
-				}
+	assetOutputLocation := fmt.Sprintf("%s/%s", c.OutputDirectory, filepath.Base(asset))
+	log.Printf("Saving asset to %s\n", assetOutputLocation)
 
-				// Read the page into memory
-				data, err := ioutil.ReadFile(pageFile)
-				if err != nil {
-					continue
-				}
+	err = ioutil.WriteFile(assetOutputLocation, fileContent, 0755)
+	if err != nil {
+		log.Fatalf("Failed to save the asset %s to %s\n", asset, assetOutputLocation)
+	}
 
-				// Get the custom Html transformer
-				customTransformer := gutenberg.NewCustomHtml(c)
+	p.Wrote(filepath.Base(asset))
+	return nil
+}
 
-				// Render the mardown
-				html := customTransformer.Transform(data)
+func WriteHighlightStylesheet(p *Process, c *config.Config) error {
+	stylesheet, err := highlight.Stylesheet(c.HighlightTheme, ".highlight")
+	if err != nil {
+		return err
+	}
 
-				// Pass to the template if it's defined
-				if pageTemplate != nil {
-					// var buffer bytes.Buffer
-					buffer := bytes.NewBuffer(nil)
-					err = pageTemplate.Execute(buffer, BuildContext(string(html), c))
-					if err != nil {
-						log.Fatalf("Failed to execute template %s\n", pageLayoutFile)
-						os.Exit(0)
-					}
+	stylesheetLocation := fmt.Sprintf("%s/highlight.css", c.OutputDirectory)
+	log.Printf("Saving highlight stylesheet to %s\n", stylesheetLocation)
 
-					// Save the data as the new page
-					html = buffer.Bytes()
-				}
+	err = ioutil.WriteFile(stylesheetLocation, stylesheet, 0755)
+	if err != nil {
+		return err
+	}
+
+	p.Wrote("highlight.css")
+	return nil
+}
+
+type pageResult struct {
+	// Everything the page logged while rendering
+	log []byte
+	err error
+}
+
+// Render the pages with a pool of workers. The log output of each page is
+// kept back and written in the order of the pages, the first page that fails
+// stops the pages that have not started yet and its error is returned.
+func GeneratePages(p *Process, c *config.Config, pageTemplate *template.Template, pages []config.TableOfContentsEntry) error {
+	workers := *jobs
+	if workers < 1 {
+		workers = 1
+	}
+
+	// One result per page so we can collect them in order
+	results := make([]chan pageResult, len(pages))
+	for i := range results {
+		results[i] = make(chan pageResult, 1)
+	}
+
+	work := make(chan int)
+	cancelled := make(chan bool)
 
-				// Let's write the resulting page out
-				err = ioutil.WriteFile(fmt.Sprintf("%s/%s.html", c.OutputDirectory, fileName), html, 0755)
-				if err != nil {
+	for i := 0; i < workers; i++ {
+		go func() {
+			for index := range work {
+				// Skip the remaining pages once a page failed
+				select {
+				case <-cancelled:
+					results[index] <- pageResult{}
 					continue
+				default:
 				}
+
+				buffer := bytes.NewBuffer(nil)
+				logger := log.New(buffer, log.Prefix(), log.Flags())
+				err := GeneratePage(p, c, pageTemplate, pages[index], logger)
+				results[index] <- pageResult{log: buffer.Bytes(), err: err}
 			}
+		}()
+	}
 
-			// Just sleep a bit and watch again
-			time.Sleep(time.Duration(delay) * time.Millisecond)
+	go func() {
+		for i := range pages {
+			work <- i
 		}
+		close(work)
 	}()
 
-	// Wait until we are done
-	<-p.Done
-}
+	// Write out the logs in order and remember the first error
+	var err error
+	for i := range pages {
+		result := <-results[i]
+		log.Writer().Write(result.log)
 
-type Page struct {
-	Page string
-}
+		if result.err != nil && err == nil {
+			err = fmt.Errorf("%s: %v", pages[i].File, result.err)
+			close(cancelled)
+		}
+	}
 
-func BuildContext(html string, c *config.Config) map[string]interface{} {
-	// var result map[string]interface{}
-	result := make(map[string]interface{})
-	result["Page"] = html
-	// Let's add all the indexes available
-	for name, c := range c.Indexes {
-		uppedName := strings.ToUpper((string)([]byte(name)[0:1])) + string([]byte(name)[1:])
-		// Add the result
-		result[uppedName] = c
+	// Remember what the pages were generated from
+	if saveErr := p.Manifest.Save(); saveErr != nil {
+		log.Printf("Failed to save the build manifest: %v\n", saveErr)
 	}
 
-	// result := map[string]interface{}
-	// return map[string]interface{}
-	return result
+	return err
 }
 
-func GenerateBook(p *Process, c *config.Config) error {
-	// Read all the layouts for html
-	htmlLayouts := c.Layouts["html"]
-	indexLayout := htmlLayouts.Index
-	pageLayout := htmlLayouts.Page
+// The files besides the page itself that every page is generated from
+func PageInputs(p *Process, c *config.Config) []string {
+	configFile := config.ConfigFile(p.Source, cfgfile)
+	configFileName, err := filepath.Rel(p.Source, configFile)
+	if err != nil {
+		configFileName = configFile
+	}
 
-	// Get the parts of the config file
-	sourcePath := config.SourcePath(source)
-	// Set the config file name
-	configFile := config.ConfigFile(sourcePath, cfgfile)
-	configFileInfo, err := os.Stat(configFile)
-	if err == nil {
-		p.ConfigFileInfo = &configFileInfo
+	return []string{configFileName, p.Format.Layout(c).Page}
+}
+
+func GeneratePage(p *Process, c *config.Config, pageTemplate *template.Template, page config.TableOfContentsEntry, logger *log.Logger) error {
+	// Skip pages whose inputs did not change since they were generated and
+	// that are in the search index
+	keys := map[string]string{"version": gutenberg.Version, "context": p.ContextKey, "format": p.Format.Name}
+	if !*force && p.Manifest.UpToDate(page.File, keys) && p.Search.Has(page.File) {
+		logger.Printf("Page %s is up to date\n", page.File)
+		return nil
 	}
 
-	// Get the right location for the page layout file
-	indexLayoutFile := fmt.Sprintf("%s/%s", p.Source, indexLayout)
-	// Get the file info for the pageLayout file
-	indexLayoutFileInfo, err := os.Stat(indexLayoutFile)
-	if err == nil {
-		p.IndexFileInfo = &indexLayoutFileInfo
+	logger.Printf("Generate page %s\n", page.File)
+
+	// Get the name of the file we are writing
+	outputName := p.PageOutputName(page)
+
+	// Read the page
+	pageFile := fmt.Sprintf("%s/%s", p.Source, page.File)
+
+	// Read the page into memory
+	data, err := ioutil.ReadFile(pageFile)
+	if err != nil {
+		return err
 	}
 
-	// Get the right location for the page layout file
-	pageLayoutFile := fmt.Sprintf("%s/%s", p.Source, pageLayout)
-	// Get the file info for the pageLayout file
-	pageLayoutFileInfo, err := os.Stat(pageLayoutFile)
-	if err == nil {
-		p.PageLayoutFileInfo = &pageLayoutFileInfo
+	// Get the renderer of the format
+	position := p.ContentsPosition(page)
+	title := page.Title
+	if position >= 0 {
+		title = p.Contents[position].Title
 	}
+	customTransformer := p.Format.Renderer(c, logger, page.OutputName(), title, LinkTargets(c), p.Labels)
 
-	// Read the page layout file in
-	layoutBytes, err := ioutil.ReadFile(pageLayoutFile)
+	// Split off the front matter
+	frontMatter, data, err := gutenberg.ParseFrontMatter(data)
 	if err != nil {
-		log.Printf("no layout file found for %s\n", pageLayoutFile)
+		return err
 	}
 
-	// Parse the template into an object
-	pageTemplate, err := template.New("pageTemplate").Parse(string(layoutBytes))
-	if err != nil {
-		log.Printf("invalid template found in %s page template file\n", pageLayoutFile)
+	// The front matter can ask for its own layout
+	layout := p.Format.Layout(c).Page
+	if frontMatter.Layout != "" {
+		layout = frontMatter.Layout
+		if _, err := os.Stat(fmt.Sprintf("%s/%s", p.Source, layout)); err != nil {
+			return fmt.Errorf("no layout file found for %s", layout)
+		}
+
+		pageTemplate = ReadTemplate(p, "pageTemplate", layout)
+		if pageTemplate == nil {
+			return fmt.Errorf("invalid template found in %s template file", layout)
+		}
 	}
 
-	// Copy over all the assets
-	for _, asset := range c.Assets {
-		assetLocation := fmt.Sprintf("%s/%s", p.Source, asset)
-		fileContent, err := ioutil.ReadFile(assetLocation)
+	// Render the mardown
+	html := customTransformer.Transform(data)
+	p.Search.Add(search.Extract(page.File, outputName, title, html))
 
-		// Get the file info for the pageLayout file
-		assetFileInfo, err := os.Stat(assetLocation)
-		if err == nil {
-			p.AssetsFileInfo[asset] = &assetFileInfo
+	// Pass to the template if it's defined
+	if pageTemplate != nil {
+		// var buffer bytes.Buffer
+		buffer := bytes.NewBuffer(nil)
+		err = pageTemplate.Execute(buffer, BuildContext(string(html), c, p.Contents, position, frontMatter))
+		if err != nil {
+			return fmt.Errorf("failed to execute template %s: %v", layout, err)
 		}
 
-		if err == nil {
-			assetOutputLocation := fmt.Sprintf("%s/%s", c.OutputDirectory, filepath.Base(asset))
-			log.Printf("Saving asset to %s\n", assetOutputLocation)
+		// Save the data as the new page
+		html = buffer.Bytes()
+	}
 
-			err = ioutil.WriteFile(assetOutputLocation, fileContent, 0755)
-			if err != nil {
-				log.Fatalf("Failed to save the asset %s to %s\n", asset, assetOutputLocation)
-			}
-		} else {
-			log.Fatalf("Could not locate the asset %s\n", asset)
+	// Let's write the resulting page out
+	err = ioutil.WriteFile(fmt.Sprintf("%s/%s", c.OutputDirectory, outputName), html, 0755)
+	if err != nil {
+		return err
+	}
+
+	p.Wrote(outputName)
+
+	// Remember what we generated the page from
+	inputs := append([]string{page.File}, PageInputs(p, c)...)
+	if frontMatter.Layout != "" {
+		inputs = append(inputs, frontMatter.Layout)
+	}
+	inputs = append(inputs, customTransformer.Dependencies()...)
+
+	// Pages with diagrams shown as their source are generated again by the
+	// next build, the renderer could be installed by then
+	if !customTransformer.Complete() {
+		return p.Manifest.RecordIncomplete(page.File, outputName, inputs, keys)
+	}
+
+	return p.Manifest.Record(page.File, outputName, inputs, keys)
+}
+
+// Returns the formats to build, the ones asked for on the command line or
+// else the default output format of the configuration
+func Formats(c *config.Config) ([]*format.Format, error) {
+	list := *formats
+	if list == "" {
+		list = c.DefaultOutputFormat
+	}
+
+	if list == "" {
+		list = "html"
+	}
+
+	return format.Select(list)
+}
+
+// Render every page with the format being generated and hand them all to its
+// packaging step
+func GeneratePackage(p *Process, c *config.Config) error {
+	BuildTableOfContents(p, c)
+	p.ContextKey = ContextKey(p, c)
+
+	var pageTemplate *template.Template
+	if layout := p.Format.Layout(c).Page; layout != "" {
+		pageTemplate = ReadTemplate(p, p.Format.Name+"Template", layout)
+		if pageTemplate == nil {
+			return fmt.Errorf("invalid layout %s for the %s format", layout, p.Format.Name)
 		}
 	}
 
-	// Read all the pages in
-	for _, page := range c.TableOfContents {
-		log.Printf("Generate page %s\n", page.File)
+	book := &format.Book{Config: c,
+		Context: func(content string) map[string]interface{} {
+			return BuildContext(content, c, p.Contents, -1, &gutenberg.FrontMatter{})
+		},
+		Write: func(name string, content []byte) error {
+			// Files that did not change are left alone so the browsers are
+			// not told to reload them
+			file := fmt.Sprintf("%s/%s", c.OutputDirectory, name)
+			if existing, err := ioutil.ReadFile(file); err == nil && bytes.Equal(existing, content) {
+				return nil
+			}
+
+			log.Printf("Saving %s/%s\n", c.OutputDirectory, name)
+			err := ioutil.WriteFile(file, content, 0755)
+			if err == nil {
+				p.Wrote(name)
+			}
 
-		// Split the file up so we can get the "name"
-		fileNameParts := strings.Split(page.File, ".")
-		fileName := strings.Join(fileNameParts[0:(len(fileNameParts)-1)], ".")
+			return err
+		},
+	}
+
+	// Remember what the package is generated from so changes to other files
+	// do not package it again
+	inputs := make(map[string]bool)
+	if c.LatexPreamble != "" {
+		inputs[filepath.ToSlash(filepath.Clean(c.LatexPreamble))] = true
+	}
 
-		// Read the page
-		pageFile := fmt.Sprintf("%s/%s", p.Source, page.File)
+	// The layout is for the whole book instead of every page
+	if p.Format.BookLayout {
+		book.Layout, pageTemplate = pageTemplate, nil
+	}
 
-		// Get the file info for the pageLayout file
-		pageFileInfo, err := os.Stat(pageFile)
+	// The assets and the highlighted code styles go with the pages
+	for _, asset := range c.Assets {
+		content, err := ioutil.ReadFile(fmt.Sprintf("%s/%s", p.Source, asset))
 		if err != nil {
-			return err
+			return fmt.Errorf("could not read the asset %s: %v", asset, err)
 		}
 
-		if err == nil {
-			p.PagesFileInfo[page.File] = &pageFileInfo
-		}
+		book.Files = append(book.Files, format.File{Name: filepath.Base(asset), Content: content})
+		inputs[filepath.ToSlash(filepath.Clean(asset))] = true
+	}
+
+	stylesheet, err := highlight.Stylesheet(c.HighlightTheme, ".highlight")
+	if err != nil {
+		return err
+	}
+	book.Files = append(book.Files, format.File{Name: "highlight.css", Content: stylesheet})
 
-		// Read the page into memory
-		data, err := ioutil.ReadFile(pageFile)
+	targets := LinkTargets(c)
+	for i, entry := range p.Contents {
+		data, err := ioutil.ReadFile(fmt.Sprintf("%s/%s", p.Source, entry.Source))
 		if err != nil {
 			return err
 		}
 
-		// Get the custom Html transformer
-		customTransformer := gutenberg.NewCustomHtml(c)
+		frontMatter, data, err := gutenberg.ParseFrontMatter(data)
+		if err != nil {
+			return fmt.Errorf("%s: %v", entry.Source, err)
+		}
+
+		transformer := p.Format.Renderer(c, nil, entry.File, entry.Title, targets, p.Labels)
+		content := transformer.Transform(data)
 
-		// Render the mardown
-		html := customTransformer.Transform(data)
+		inputs[filepath.ToSlash(filepath.Clean(entry.Source))] = true
+		for _, dependency := range transformer.Dependencies() {
+			inputs[filepath.ToSlash(filepath.Clean(dependency))] = true
+		}
 
-		// Pass to the template if it's defined
 		if pageTemplate != nil {
-			// var buffer bytes.Buffer
 			buffer := bytes.NewBuffer(nil)
-			err = pageTemplate.Execute(buffer, BuildContext(string(html), c))
+			err = pageTemplate.Execute(buffer, BuildContext(string(content), c, p.Contents, i, frontMatter))
 			if err != nil {
-				log.Fatalf("Failed to execute template %s\n", pageLayoutFile)
-				os.Exit(0)
+				return fmt.Errorf("failed to execute template %s: %v", p.Format.Layout(c).Page, err)
 			}
 
-			// Save the data as the new page
-			html = buffer.Bytes()
+			content = buffer.Bytes()
 		}
 
-		// Let's write the resulting page out
-		err = ioutil.WriteFile(fmt.Sprintf("%s/%s.html", c.OutputDirectory, fileName), html, 0755)
-		if err != nil {
-			return err
-		}
+		book.Pages = append(book.Pages, format.Page{Source: entry.Source,
+			File:    entry.File,
+			Title:   entry.Title,
+			Number:  entry.Number,
+			Content: content,
+		})
+	}
+
+	log.Printf("Package %s\n", p.Format.Name)
+	err = p.Format.Package(book)
+	if err != nil {
+		return err
 	}
 
+	if p.PackageInputs == nil {
+		p.PackageInputs = make(map[string]map[string]bool)
+	}
+	p.PackageInputs[p.Format.Name] = inputs
 	return nil
 }
 
+// Returns true if one of the changed files is one the package of the format
+// was generated from, or if the package was not generated yet
+func PackageChanged(p *Process, f *format.Format, changed map[string]bool) bool {
+	inputs, ok := p.PackageInputs[f.Name]
+	if !ok {
+		return true
+	}
+
+	for file := range changed {
+		if inputs[file] {
+			return true
+		}
+	}
+
+	return false
+}
+
 func GenerateWholeBook(p *Process) error {
 	// Get the parts of the config file
 	sourcePath := config.SourcePath(source)
@@ -407,66 +1476,54 @@ func GenerateWholeBook(p *Process) error {
 	// Read the configuration
 	c, err := config.ReadConfigFromFile(cfgfile, source)
 	if err != nil {
-		fmt.Printf("Error:: %v\n", err)
-		p.Done <- true
+		PrintErr("Error:: %v", err)
 		return err
 	}
 
 	// Set the source path
 	c.SourcePath = sourcePath
 
-	// Process and generate the book
-	log.Printf("Generating Book\n")
-	err = GenerateBook(p, c)
+	// Let the browsers know once we are done
+	defer p.Reload()
+
+	// Refuse to build a book with missing files
+	problems := CheckBook(p.Source, c)
+	if len(problems) > 0 {
+		for _, problem := range problems {
+			log.Printf("%v\n", problem)
+		}
+
+		err = fmt.Errorf("the book has %d problems, see gutenberg check", len(problems))
+		PrintErr("Error:: %v", err)
+		return err
+	}
+
+	selected, err := Formats(c)
 	if err != nil {
-		fmt.Printf("Error:: %v\n", err)
-		p.Done <- true
+		PrintErr("Error:: %v", err)
 		return err
 	}
 
+	// Process and generate the book in every format
+	for _, f := range selected {
+		log.Printf("Generating Book as %s\n", f.Name)
+		p.Format = f
+		if f.Package == nil {
+			err = GenerateBook(p, c)
+		} else {
+			err = GeneratePackage(p, c)
+		}
+
+		if err != nil {
+			PrintErr("Error:: %v", err)
+			return err
+		}
+	}
+
 	return nil
 }
 
-// func WatchMode(delay int64, p *Process) error {
-// 	go func() {
-// 		for true {
-// 			// Get the parts of the config file
-// 			sourcePath := config.SourcePath(source)
-// 			// Set the config file name
-// 			configFile := config.ConfigFile(sourcePath, cfgfile)
-// 			// Log the attempt to read the configuration file
-// 			log.Printf("Reading configuration file %s\n", configFile)
-// 			// Read the configuration
-// 			c, err := config.ReadConfigFromFile(cfgfile, source)
-// 			if err != nil {
-// 				fmt.Printf("Error:: %v\n", err)
-// 				p.Done <- true
-// 				break
-// 			}
-
-// 			// Set the source path
-// 			c.SourcePath = sourcePath
-
-// 			// Process and generate the book
-// 			log.Printf("Generating Book\n")
-// 			err = GenerateBook(p, c)
-// 			if err != nil {
-// 				fmt.Printf("Error:: %v\n", err)
-// 				p.Done <- true
-// 				break
-// 			}
-
-// 			// Just sleep a bit
-// 			time.Sleep(time.Duration(delay) * time.Millisecond)
-// 		}
-// 	}()
-
-// 	// Wait until we are done
-// 	<-p.Done
-// 	// Return from Watch mode
-// 	return nil
-// }
-
+// Print a line to standard error
 func PrintErr(str string, a ...interface{}) {
-	fmt.Fprintln(os.Stderr, str, a)
+	fmt.Fprintf(os.Stderr, str+"\n", a...)
 }